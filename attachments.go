@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"email-api/mail"
+)
+
+// Adjunto enviado por la API como contenido base64
+type AttachmentRequest struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     string `json:"content"`
+}
+
+// Límites para los adjuntos recibidos por la API
+type attachmentLimits struct {
+	MaxFileSize  int64
+	MaxTotalSize int64
+	MaxCount     int
+}
+
+var errAttachmentTooLarge = errors.New("adjunto demasiado grande")
+
+// Extensiones que los clientes de correo bloquean o que pueden ejecutar código
+var blockedExtensions = map[string]bool{
+	".exe": true, ".bat": true, ".cmd": true, ".com": true, ".scr": true,
+	".pif": true, ".cpl": true, ".msi": true, ".msp": true, ".dll": true,
+	".js": true, ".jse": true, ".vbs": true, ".vbe": true, ".wsf": true,
+	".wsh": true, ".hta": true, ".ps1": true, ".psm1": true, ".jar": true,
+	".lnk": true, ".reg": true, ".sh": true, ".app": true, ".apk": true,
+	".iso": true, ".img": true,
+}
+
+// Leer los límites desde el entorno (por defecto 10MB por archivo, 20MB en total y 10 adjuntos)
+func loadAttachmentLimits() attachmentLimits {
+	return attachmentLimits{
+		MaxFileSize:  envInt64("ATTACHMENT_MAX_FILE_SIZE", 10<<20),
+		MaxTotalSize: envInt64("ATTACHMENT_MAX_TOTAL_SIZE", 20<<20),
+		MaxCount:     int(envInt64("ATTACHMENT_MAX_COUNT", 10)),
+	}
+}
+
+func envInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// Decodificar y validar los adjuntos base64 de una petición JSON
+func decodeAttachments(reqs []AttachmentRequest, limits attachmentLimits) ([]mail.Attachment, error) {
+	if len(reqs) > limits.MaxCount {
+		return nil, fmt.Errorf("se permiten como máximo %d adjuntos", limits.MaxCount)
+	}
+
+	var attachments []mail.Attachment
+	var total int64
+	for _, req := range reqs {
+		// Rechazar antes de decodificar si el base64 ya excede el límite
+		if int64(base64.StdEncoding.DecodedLen(len(req.Content))) > limits.MaxFileSize+2 {
+			return nil, fmt.Errorf("%w: %s supera %d bytes", errAttachmentTooLarge, req.Filename, limits.MaxFileSize)
+		}
+		content, err := base64.StdEncoding.DecodeString(req.Content)
+		if err != nil {
+			return nil, fmt.Errorf("contenido base64 inválido en %s: %v", req.Filename, err)
+		}
+
+		attachment, err := validateAttachment(req.Filename, req.ContentType, content, limits)
+		if err != nil {
+			return nil, err
+		}
+		total += int64(len(content))
+		if total > limits.MaxTotalSize {
+			return nil, fmt.Errorf("%w: el total supera %d bytes", errAttachmentTooLarge, limits.MaxTotalSize)
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+// Leer y validar los archivos "attachments" de un formulario multipart
+func multipartAttachments(form *multipart.Form, limits attachmentLimits) ([]mail.Attachment, error) {
+	files := form.File["attachments"]
+	if len(files) > limits.MaxCount {
+		return nil, fmt.Errorf("se permiten como máximo %d adjuntos", limits.MaxCount)
+	}
+
+	var attachments []mail.Attachment
+	var total int64
+	for _, header := range files {
+		if header.Size > limits.MaxFileSize {
+			return nil, fmt.Errorf("%w: %s supera %d bytes", errAttachmentTooLarge, header.Filename, limits.MaxFileSize)
+		}
+		total += header.Size
+		if total > limits.MaxTotalSize {
+			return nil, fmt.Errorf("%w: el total supera %d bytes", errAttachmentTooLarge, limits.MaxTotalSize)
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		attachment, err := validateAttachment(header.Filename, header.Header.Get("Content-Type"), content, limits)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+// Validar nombre, tamaño y tipo de un adjunto. El tipo detectado por el
+// contenido tiene prioridad sobre el declarado por el cliente.
+func validateAttachment(filename string, declaredType string, content []byte, limits attachmentLimits) (mail.Attachment, error) {
+	filename = filepath.Base(strings.TrimSpace(filename))
+	if filename == "" || filename == "." || filename == "/" {
+		return mail.Attachment{}, errors.New("el adjunto requiere un nombre de archivo")
+	}
+	if int64(len(content)) > limits.MaxFileSize {
+		return mail.Attachment{}, fmt.Errorf("%w: %s supera %d bytes", errAttachmentTooLarge, filename, limits.MaxFileSize)
+	}
+	if blockedExtensions[strings.ToLower(filepath.Ext(filename))] {
+		return mail.Attachment{}, fmt.Errorf("tipo de archivo no permitido: %s", filename)
+	}
+	// Ejecutables de Windows (cabecera MZ) aunque tengan otra extensión
+	if bytes.HasPrefix(content, []byte("MZ")) {
+		return mail.Attachment{}, fmt.Errorf("tipo de archivo no permitido: %s", filename)
+	}
+
+	contentType := http.DetectContentType(content)
+	sniffed, _, _ := mime.ParseMediaType(contentType)
+
+	// application/octet-stream (el valor por defecto de muchos clientes) no declara nada
+	declared := ""
+	if declaredType != "" {
+		var err error
+		declared, _, err = mime.ParseMediaType(declaredType)
+		if err != nil {
+			return mail.Attachment{}, fmt.Errorf("content_type inválido en %s: %v", filename, err)
+		}
+	}
+
+	if declared != "" && declared != "application/octet-stream" {
+		if !sniffCompatible(sniffed, declared) {
+			return mail.Attachment{}, fmt.Errorf("el contenido de %s (%s) no coincide con %s", filename, sniffed, declared)
+		}
+		contentType = declaredType
+	} else if sniffCompatible(sniffed, "") {
+		if byExtension := mime.TypeByExtension(filepath.Ext(filename)); byExtension != "" {
+			contentType = byExtension
+		}
+	}
+
+	return mail.Attachment{Filename: filename, ContentType: contentType, Content: content}, nil
+}
+
+// Tipos que el sniffing no distingue: texto genérico, XML y formatos basados
+// en ZIP como docx, xlsx u odt
+func sniffCompatible(sniffed string, declared string) bool {
+	switch sniffed {
+	case "application/octet-stream", "text/plain", "text/xml":
+		return true
+	case "application/zip":
+		return declared == "" || strings.Contains(declared, "openxmlformats") ||
+			strings.Contains(declared, "opendocument") || strings.HasSuffix(declared, "+zip")
+	}
+	return sniffed == declared
+}
+
+// Código HTTP para un error de adjuntos
+func attachmentErrorStatus(err error) int {
+	if errors.Is(err, errAttachmentTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return bodyErrorStatus(err)
+}
+
+// Decodificar /send-email como JSON (adjuntos en base64) o como
+// multipart/form-data (campos mail, subject, body y archivos "attachments")
+func decodeEmailRequest(w http.ResponseWriter, r *http.Request, limits attachmentLimits) (EmailRequest, []mail.Attachment, error) {
+	var emailReq EmailRequest
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		if err := json.NewDecoder(r.Body).Decode(&emailReq); err != nil {
+			return emailReq, nil, fmt.Errorf("error al procesar el JSON: %w", err)
+		}
+		attachments, err := decodeAttachments(emailReq.Attachments, limits)
+		return emailReq, attachments, err
+	}
+
+	// Margen de 1MB para los campos de texto y las cabeceras de cada parte
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxTotalSize+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return emailReq, nil, fmt.Errorf("error al procesar el formulario: %w", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	emailReq.Mail = r.FormValue("mail")
+	emailReq.Subject = r.FormValue("subject")
+	emailReq.Body = r.FormValue("body")
+	emailReq.To = formRecipients(r.MultipartForm.Value["to"])
+	emailReq.Cc = formRecipients(r.MultipartForm.Value["cc"])
+	emailReq.Bcc = formRecipients(r.MultipartForm.Value["bcc"])
+	if replyTo := r.FormValue("reply_to"); replyTo != "" {
+		emailReq.ReplyTo = &Recipient{Email: replyTo}
+	}
+
+	attachments, err := multipartAttachments(r.MultipartForm, limits)
+	return emailReq, attachments, err
+}
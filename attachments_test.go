@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testLimits = attachmentLimits{MaxFileSize: 1024, MaxTotalSize: 1536, MaxCount: 3}
+
+func b64(content string) string {
+	return base64.StdEncoding.EncodeToString([]byte(content))
+}
+
+func TestDecodeAttachments(t *testing.T) {
+	attachments, err := decodeAttachments([]AttachmentRequest{
+		{Filename: "factura.pdf", Content: b64("%PDF-1.4 factura")},
+		{Filename: "clientes.csv", ContentType: "text/csv", Content: b64("email,nombre\n")},
+		{Filename: "../../etc/notas.txt", Content: b64("hola")},
+	}, testLimits)
+	require.NoError(t, err)
+	require.Len(t, attachments, 3)
+	require.Equal(t, "application/pdf", attachments[0].ContentType)
+	require.Equal(t, "text/csv", attachments[1].ContentType)
+	require.Equal(t, "notas.txt", attachments[2].Filename)
+}
+
+func TestDecodeAttachmentsRejects(t *testing.T) {
+	tests := map[string]struct {
+		reqs   []AttachmentRequest
+		status int
+	}{
+		"extensión bloqueada": {
+			reqs:   []AttachmentRequest{{Filename: "setup.EXE", Content: b64("hola")}},
+			status: http.StatusBadRequest,
+		},
+		"ejecutable disfrazado": {
+			reqs:   []AttachmentRequest{{Filename: "factura.pdf", Content: b64("MZ\x90\x00")}},
+			status: http.StatusBadRequest,
+		},
+		"tipo declarado no coincide": {
+			reqs:   []AttachmentRequest{{Filename: "foto.png", ContentType: "image/png", Content: b64("%PDF-1.4")}},
+			status: http.StatusBadRequest,
+		},
+		"base64 inválido": {
+			reqs:   []AttachmentRequest{{Filename: "a.txt", Content: "###"}},
+			status: http.StatusBadRequest,
+		},
+		"demasiados adjuntos": {
+			reqs:   make([]AttachmentRequest, 4),
+			status: http.StatusBadRequest,
+		},
+		"archivo demasiado grande": {
+			reqs:   []AttachmentRequest{{Filename: "a.txt", Content: b64(string(make([]byte, 2048)))}},
+			status: http.StatusRequestEntityTooLarge,
+		},
+		"total demasiado grande": {
+			reqs: []AttachmentRequest{
+				{Filename: "a.txt", Content: b64(string(bytes.Repeat([]byte("a"), 1000)))},
+				{Filename: "b.txt", Content: b64(string(bytes.Repeat([]byte("b"), 1000)))},
+			},
+			status: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := decodeAttachments(tc.reqs, testLimits)
+			require.Error(t, err)
+			require.Equal(t, tc.status, attachmentErrorStatus(err))
+		})
+	}
+}
+
+func TestDecodeEmailRequestMultipart(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("mail", "Juan")
+	form.WriteField("subject", "Catálogo")
+	form.WriteField("body", "Adjunto el catálogo")
+	part, err := form.CreateFormFile("attachments", "catalogo.pdf")
+	require.NoError(t, err)
+	part.Write([]byte("%PDF-1.4 catálogo"))
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/send-email", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	emailReq, attachments, err := decodeEmailRequest(httptest.NewRecorder(), req, testLimits)
+	require.NoError(t, err)
+	require.Equal(t, "Catálogo", emailReq.Subject)
+	require.Len(t, attachments, 1)
+	require.Equal(t, "catalogo.pdf", attachments[0].Filename)
+	require.Equal(t, "application/pdf", attachments[0].ContentType)
+}
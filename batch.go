@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"email-api/mail"
+)
+
+// Envío de recomendaciones a una audiencia de contactos
+type BatchRecommendationRequest struct {
+	Audience        ContactFilter `json:"audience"`
+	Subject         string        `json:"subject"`
+	Products        []Product     `json:"products"`
+	CallToActionURL string        `json:"call_to_action_url"`
+	PhoneNumber     string        `json:"phone_number"`
+	InlineImages    bool          `json:"inline_images,omitempty"`
+	// Campos de combinación comunes; los del contacto se agregan en "contact"
+	Data map[string]any `json:"data,omitempty"`
+	// Idioma para todo el lote; si falta se usa el de cada contacto
+	Locale string `json:"locale,omitempty"`
+	Brand  string `json:"brand,omitempty"`
+}
+
+// Respuesta con los contactos del lote; los mensajes se arman en la cola
+type BatchResponse struct {
+	BatchID string `json:"batch_id"`
+	Queued  int    `json:"queued"`
+	Status  string `json:"status"`
+}
+
+// Lote guardado en la cola como un solo elemento. Los workers arman el
+// mensaje de cada contacto; Next marca el avance para retomarlo tras un
+// reinicio.
+type batchJob struct {
+	Request  BatchRecommendationRequest `json:"request"`
+	Contacts []Contact                  `json:"contacts"`
+	Next     int                        `json:"next"`
+	Queued   int                        `json:"queued"`
+	Skipped  int                        `json:"skipped"`
+}
+
+// Cada cuántos contactos se guarda el avance del lote. Reescribir el lote
+// completo por contacto haría cuadrático el costo en disco; si el proceso
+// muere sin apagarse, hasta este número de contactos puede recibir el
+// correo dos veces.
+const batchCheckpoint = 100
+
+// Armar el mensaje de recomendaciones personalizado para un contacto
+func recommendationForContact(ctx context.Context, req BatchRecommendationRequest, contact Contact, inlineImages []mail.Attachment) (mail.Message, error) {
+	data, err := recommendationData(RecommendationRequest{
+		Subject:         req.Subject,
+		Products:        req.Products,
+		CallToActionURL: req.CallToActionURL,
+		PhoneNumber:     req.PhoneNumber,
+		Data:            req.Data,
+		Locale:          req.Locale,
+		Brand:           req.Brand,
+	}, &contact)
+	if err != nil {
+		return mail.Message{}, err
+	}
+	_, span := tracer.Start(ctx, "render recommendation.html")
+	htmlContent, err := generateRecommendationHTML(data)
+	if err == nil {
+		htmlContent = prepareEmailHTML(htmlContent)
+	}
+	endSpan(span, err)
+	if err != nil {
+		return mail.Message{}, err
+	}
+	lintRendered("recommendation", htmlContent, "")
+	subject, err := renderText("subject", req.Subject, data)
+	if err != nil {
+		return mail.Message{}, err
+	}
+
+	builder := mail.NewMessage().
+		To(contact.Recipient().String()).
+		Subject(subject).
+		HTML(htmlContent).
+		Tag("recommendation", "batch")
+	for _, img := range inlineImages {
+		builder.Inline(img.ContentID, img.Filename, img.ContentType, img.Content)
+	}
+	return builder.Build()
+}
+
+// Handler para encolar recomendaciones a los contactos de la audiencia
+func batchRecommendationHandler(w http.ResponseWriter, r *http.Request) {
+	var req BatchRecommendationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
+		return
+	}
+	if req.Subject == "" {
+		http.Error(w, "subject es requerido", http.StatusBadRequest)
+		return
+	}
+	if err := req.checkTextLimits(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	products, err := normalizeProducts(req.Products)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Products = products
+	if _, err := themes.Resolve(req.Brand); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Evitar enviar a toda la base por olvidar el filtro
+	if req.Audience.empty() && !req.Audience.All {
+		http.Error(w, "audience requiere algún filtro o \"all\": true", http.StatusBadRequest)
+		return
+	}
+	switch req.Audience.Status {
+	case "":
+		req.Audience.Status = StatusSubscribed
+	case StatusSubscribed:
+	default:
+		http.Error(w, "solo se puede enviar a contactos suscritos", http.StatusBadRequest)
+		return
+	}
+
+	audience := contacts.List(req.Audience)
+	if len(audience) == 0 {
+		http.Error(w, "ningún contacto cumple el filtro", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if _, ok := configuredSender(); !ok {
+		slog.WarnContext(r.Context(), "configuración de email no encontrada, respondiendo sin enviar")
+		writeJSON(w, http.StatusOK, BatchResponse{Status: "not_configured"})
+		return
+	}
+
+	// Renderizar y encolar cada contacto puede superar el WriteTimeout con
+	// audiencias grandes: la petición solo guarda el lote
+	batchID := newQueueID()
+	if _, err := queue.EnqueueBatch(r.Context(), batchID, batchJob{Request: req, Contacts: audience}); err != nil {
+		slog.ErrorContext(r.Context(), "error al encolar el lote", "batch_id", batchID, "error", err)
+		http.Error(w, fmt.Sprintf("Error al encolar: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "lote recibido", "batch_id", batchID, "contacts", len(audience))
+	writeJSON(w, http.StatusAccepted, BatchResponse{BatchID: batchID, Queued: len(audience), Status: "queued"})
+}
+
+// Armar y encolar el mensaje de cada contacto del lote desde un worker. Al
+// apagarse guarda el avance y el lote sigue en el próximo arranque.
+func (q *sendQueue) expandBatch(ctx context.Context, item queuedMessage) error {
+	job := item.Job
+	save := func() error { return writeJSONFile(q.path(item.ID), item) }
+
+	// Las imágenes se descargan una sola vez para todo el lote; el pedido
+	// guardado conserva las URLs por si hay que retomarlo
+	req := job.Request
+	var inlineImages []mail.Attachment
+	if req.InlineImages || os.Getenv("INLINE_PRODUCT_IMAGES") == "true" {
+		req.Products, inlineImages = embedProductImages(ctx, productImageFetcher, req.Products)
+	}
+
+	for job.Next < len(job.Contacts) {
+		select {
+		case <-q.stopping:
+			return save()
+		default:
+		}
+		if ctx.Err() != nil {
+			return save()
+		}
+
+		contact := job.Contacts[job.Next]
+		msg, err := recommendationForContact(ctx, req, contact, inlineImages)
+		if err != nil {
+			// Por ejemplo, un campo requerido que el contacto no tiene
+			slog.WarnContext(ctx, "contacto omitido en el lote", "batch_id", item.Batch, "email", contact.Email, "error", err)
+			job.Skipped++
+		} else if _, err := q.Enqueue(ctx, item.Batch, msg); err != nil {
+			// Se retoma desde este contacto después de la espera de reintento
+			time.AfterFunc(q.retryDelay, func() { q.push(item.ID) })
+			return errors.Join(err, save())
+		} else {
+			job.Queued++
+		}
+		job.Next++
+		if job.Next%batchCheckpoint == 0 {
+			if err := save(); err != nil {
+				return err
+			}
+		}
+	}
+
+	slog.InfoContext(ctx, "lote encolado", "batch_id", item.Batch, "queued", job.Queued, "skipped", job.Skipped)
+	q.done(item.ID)
+	return os.Remove(q.path(item.ID))
+}
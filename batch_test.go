@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"email-api/mail"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Cola temporal sin workers: los mensajes quedan encolados para revisarlos
+func useTestQueue(t *testing.T) *sendQueue {
+	t.Helper()
+	saved := queue
+	t.Cleanup(func() { queue = saved })
+	var err error
+	queue, err = newSendQueue(t.TempDir(), func(context.Context, mail.Message) error { return nil }, 1, time.Millisecond)
+	require.NoError(t, err)
+	return queue
+}
+
+func TestBatchRecommendationHandler(t *testing.T) {
+	t.Setenv("EMAIL_SENDER_ADDRESS", "tienda@ejemplo.com")
+	t.Setenv("EMAIL_SENDER_PASSWORD", "secreto")
+	useTestContacts(t,
+		Contact{Email: "ana@ejemplo.com", Name: "Ana", Tags: []string{"vip"}, Attributes: map[string]string{"plan": "pro"}},
+		Contact{Email: "beto@ejemplo.com", Name: "Beto", Tags: []string{"vip"}},
+		Contact{Email: "carla@ejemplo.com", Name: "Carla", Tags: []string{"vip"}, Status: StatusUnsubscribed},
+		Contact{Email: "dario@ejemplo.com", Name: "Darío", Attributes: map[string]string{"plan": "pro"}},
+	)
+	q := useTestQueue(t)
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		batchRecommendationHandler(rec, httptest.NewRequest(http.MethodPost, "/recommendations/batch", strings.NewReader(body)))
+		return rec
+	}
+
+	tests := map[string]struct {
+		body   string
+		status int
+	}{
+		"sin subject":         {`{"audience": {"tags": ["vip"]}}`, http.StatusBadRequest},
+		"sin filtro":          {`{"subject": "Hola", "audience": {}}`, http.StatusBadRequest},
+		"no suscritos":        {`{"subject": "Hola", "audience": {"tags": ["vip"], "status": "unsubscribed"}}`, http.StatusBadRequest},
+		"nadie cumple":        {`{"subject": "Hola", "audience": {"tags": ["invierno"]}}`, http.StatusUnprocessableEntity},
+		"producto inválido":   {`{"subject": "Hola", "audience": {"all": true}, "products": [{"name": "A", "price": -1}]}`, http.StatusBadRequest},
+		"marca desconocida":   {`{"subject": "Hola", "audience": {"all": true}, "brand": "nadie"}`, http.StatusBadRequest},
+		"JSON inválido":       {`{`, http.StatusBadRequest},
+		"subject muy extenso": {`{"subject": "` + strings.Repeat("a", maxShortText+1) + `", "audience": {"all": true}}`, http.StatusBadRequest},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := serve(tc.body)
+			require.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+	depth, _ := q.Stats()
+	require.Zero(t, depth)
+
+	// Solo los suscritos con la etiqueta; la petición guarda el lote sin
+	// armar los mensajes
+	rec := serve(`{"subject": "Hola {{.contact.plan | required \"plan\"}}", "audience": {"tags": ["vip"]},
+		"products": [{"name": "Auriculares", "buy_url": "https://tienda.com/a"}]}`)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	var resp BatchResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.NotEmpty(t, resp.BatchID)
+	require.Equal(t, BatchResponse{BatchID: resp.BatchID, Queued: 2, Status: "queued"}, resp)
+	require.Equal(t, 1, q.Len())
+
+	// El worker arma un mensaje por contacto; Beto no tiene el campo requerido
+	jobID, ok := q.pop()
+	require.True(t, ok)
+	require.NoError(t, q.process(context.Background(), jobID))
+	require.NoFileExists(t, q.path(jobID))
+	msgID, ok := q.pop()
+	require.True(t, ok)
+	data, err := os.ReadFile(q.path(msgID))
+	require.NoError(t, err)
+	var item queuedMessage
+	require.NoError(t, json.Unmarshal(data, &item))
+	require.Equal(t, resp.BatchID, item.Batch)
+	require.Equal(t, "Hola pro", item.Message.Subject)
+	require.Equal(t, "ana@ejemplo.com", item.Message.To[0].Address)
+	_, ok = q.pop()
+	require.False(t, ok)
+	depth, _ = q.Stats()
+	require.Equal(t, 1, depth)
+
+	// Sin configuración de email no se encola nada
+	t.Setenv("EMAIL_SENDER_ADDRESS", "")
+	rec = serve(`{"subject": "Hola", "audience": {"all": true}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"batch_id": "", "queued": 0, "status": "not_configured"}`, rec.Body.String())
+	depth, _ = q.Stats()
+	require.Equal(t, 1, depth)
+}
+
+func TestExpandBatchResumes(t *testing.T) {
+	q := useTestQueue(t)
+	var list []Contact
+	for i := range batchCheckpoint + 5 {
+		list = append(list, Contact{Email: fmt.Sprintf("c%d@ejemplo.com", i), Status: StatusSubscribed})
+	}
+	job := batchJob{Request: BatchRecommendationRequest{Subject: "Hola"}, Contacts: list}
+	jobID, err := q.EnqueueBatch(context.Background(), "lote", job)
+	require.NoError(t, err)
+
+	// Al apagarse el avance queda guardado y no se pierde el lote
+	q.stopOnce.Do(func() { close(q.stopping) })
+	id, _ := q.pop()
+	require.NoError(t, q.process(context.Background(), id))
+	require.FileExists(t, q.path(jobID))
+	require.Zero(t, q.Len())
+
+	// Retomar desde el contacto guardado
+	data, err := os.ReadFile(q.path(jobID))
+	require.NoError(t, err)
+	var item queuedMessage
+	require.NoError(t, json.Unmarshal(data, &item))
+	item.Job.Next = batchCheckpoint
+	require.NoError(t, writeJSONFile(q.path(jobID), item))
+
+	q.stopping = make(chan struct{})
+	q.stopOnce = sync.Once{}
+	require.NoError(t, q.process(context.Background(), jobID))
+	require.NoFileExists(t, q.path(jobID))
+	require.Equal(t, 5, q.Len())
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"email-api/mail"
+)
+
+// Estructura para crear, actualizar o cancelar una invitación de calendario
+type CalendarInviteRequest struct {
+	UID         string      `json:"uid,omitempty"`
+	Summary     string      `json:"summary"`
+	Description string      `json:"description,omitempty"`
+	Location    string      `json:"location,omitempty"`
+	PhoneNumber string      `json:"phone_number,omitempty"`
+	Start       time.Time   `json:"start"`
+	End         time.Time   `json:"end"`
+	TimeZone    string      `json:"timezone,omitempty"`
+	Attendees   []Recipient `json:"attendees"`
+}
+
+// Respuesta con el UID para futuras actualizaciones o cancelaciones
+type CalendarInviteResponse struct {
+	UID      string `json:"uid"`
+	Sequence int    `json:"sequence"`
+	Status   string `json:"status"`
+}
+
+// Invitación guardada para poder actualizarla o cancelarla
+type storedInvite struct {
+	CalendarInviteRequest
+	Sequence  int  `json:"sequence"`
+	Cancelled bool `json:"cancelled"`
+}
+
+// Almacén de invitaciones en un archivo JSON
+type inviteStore struct {
+	mu      sync.Mutex
+	path    string
+	invites map[string]storedInvite
+}
+
+var invites *inviteStore
+
+var errInviteNotFound = errors.New("invitación no encontrada")
+
+func newInviteStore(path string) (*inviteStore, error) {
+	store := &inviteStore{path: path, invites: make(map[string]storedInvite)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.invites); err != nil {
+		return nil, fmt.Errorf("error al leer %s: %v", path, err)
+	}
+	return store, nil
+}
+
+func (s *inviteStore) Get(uid string) (storedInvite, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invite, ok := s.invites[uid]
+	return invite, ok
+}
+
+func (s *inviteStore) Save(invite storedInvite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invites[invite.UID] = invite
+	return writeJSONFile(s.path, s.invites)
+}
+
+// Escribir en un archivo temporal y renombrar para no dejar el JSON a medias
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newInviteUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b) + "@email-api"
+}
+
+// Combinar una actualización con la invitación guardada; los campos vacíos se mantienen
+func mergeInvite(current CalendarInviteRequest, update CalendarInviteRequest) CalendarInviteRequest {
+	if update.Summary != "" {
+		current.Summary = update.Summary
+	}
+	if update.Description != "" {
+		current.Description = update.Description
+	}
+	if update.Location != "" {
+		current.Location = update.Location
+	}
+	if update.PhoneNumber != "" {
+		current.PhoneNumber = update.PhoneNumber
+	}
+	if !update.Start.IsZero() {
+		current.Start = update.Start
+	}
+	if !update.End.IsZero() {
+		current.End = update.End
+	}
+	if update.TimeZone != "" {
+		current.TimeZone = update.TimeZone
+	}
+	if len(update.Attendees) > 0 {
+		current.Attendees = update.Attendees
+	}
+	return current
+}
+
+// Construir el evento iCalendar de una invitación
+func buildEvent(invite storedInvite, method mail.CalendarMethod, organizer *netmail.Address) (mail.Event, error) {
+	timezone := invite.TimeZone
+	if timezone == "" {
+		timezone = os.Getenv("DEFAULT_TIMEZONE")
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return mail.Event{}, fmt.Errorf("zona horaria inválida %q: %v", timezone, err)
+	}
+
+	var attendees []*netmail.Address
+	for _, a := range invite.Attendees {
+		addr, err := a.Address()
+		if err != nil {
+			return mail.Event{}, err
+		}
+		attendees = append(attendees, addr)
+	}
+
+	return mail.Event{
+		UID:         invite.UID,
+		Sequence:    invite.Sequence,
+		Method:      method,
+		Organizer:   organizer,
+		Attendees:   attendees,
+		Start:       invite.Start,
+		End:         invite.End,
+		TimeZone:    loc,
+		Summary:     invite.Summary,
+		Description: invite.Description,
+		Place:       invite.Location,
+		Phone:       invite.PhoneNumber,
+	}, nil
+}
+
+// Cuerpo HTML y texto de la invitación
+func inviteBodies(event mail.Event) (string, string) {
+	when := fmt.Sprintf("%s - %s (%s)",
+		event.Start.In(event.TimeZone).Format("02/01/2006 15:04"),
+		event.End.In(event.TimeZone).Format("15:04"),
+		event.TimeZone)
+	where := event.Place
+	if where == "" {
+		where = event.Phone
+	}
+
+	htmlBody := fmt.Sprintf(`
+		<h2>%s</h2>
+		<p><strong>Cuándo:</strong> %s</p>
+		<p><strong>Dónde:</strong> %s</p>
+		<p>%s</p>
+	`, html.EscapeString(event.Summary), html.EscapeString(when), html.EscapeString(where), html.EscapeString(event.Description))
+	textBody := fmt.Sprintf("%s\n\nCuándo: %s\nDónde: %s\n\n%s", event.Summary, when, where, event.Description)
+	return htmlBody, textBody
+}
+
+// Enviar la invitación (REQUEST) o la cancelación (CANCEL) a los asistentes
+func sendInvite(ctx context.Context, sender mail.EmailSender, event mail.Event, ics []byte) error {
+	subject := "Invitación: " + event.Summary
+	switch {
+	case event.Method == mail.CalendarCancel:
+		subject = "Cancelada: " + event.Summary
+	case event.Sequence > 0:
+		subject = "Actualizada: " + event.Summary
+	}
+	htmlBody, textBody := inviteBodies(event)
+
+	builder := mail.NewMessage()
+	for _, attendee := range event.Attendees {
+		builder.To(attendee.String())
+	}
+	msg, err := builder.
+		Subject(subject).
+		HTML(htmlBody).
+		Text(textBody).
+		Calendar(event.Method, ics).
+		Attach("invite.ics", event.ContentType(), ics).
+		Tag("calendar-invite").
+		Build()
+	if err != nil {
+		return err
+	}
+	return sender.Send(ctx, msg)
+}
+
+// Handler para invitaciones de calendario: POST crea, PUT actualiza y DELETE cancela
+func calendarInviteHandler(w http.ResponseWriter, r *http.Request) {
+	var invite storedInvite
+	method := mail.CalendarRequest
+
+	switch r.Method {
+	case http.MethodPost:
+		var req CalendarInviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
+			return
+		}
+		req.UID = newInviteUID()
+		invite = storedInvite{CalendarInviteRequest: req}
+
+	case http.MethodPut:
+		var req CalendarInviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
+			return
+		}
+		current, ok := invites.Get(req.UID)
+		if !ok || current.Cancelled {
+			http.Error(w, errInviteNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		invite = storedInvite{CalendarInviteRequest: mergeInvite(current.CalendarInviteRequest, req), Sequence: current.Sequence + 1}
+
+	case http.MethodDelete:
+		current, ok := invites.Get(r.URL.Query().Get("uid"))
+		if !ok || current.Cancelled {
+			http.Error(w, errInviteNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		invite = current
+		invite.Sequence++
+		invite.Cancelled = true
+		method = mail.CalendarCancel
+	}
+
+	if invite.Summary == "" || len(invite.Attendees) == 0 {
+		http.Error(w, "summary y attendees son requeridos", http.StatusBadRequest)
+		return
+	}
+	if err := invite.checkTextLimits(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	emailName := os.Getenv("EMAIL_SENDER_NAME")
+	emailAddress := os.Getenv("EMAIL_SENDER_ADDRESS")
+	emailPassword := os.Getenv("EMAIL_SENDER_PASSWORD")
+
+	// El organizador debe ser el remitente para que Gmail y Outlook muestren los botones
+	organizer := &netmail.Address{Name: emailName, Address: emailAddress}
+	event, err := buildEvent(invite, method, organizer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ics, err := event.ICS()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invitación inválida: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if emailAddress == "" || !emailCredentialsConfigured(emailPassword) {
+		slog.WarnContext(r.Context(), "configuración de email no encontrada, respondiendo sin enviar")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Invitación configurada pero no enviada (falta configuración)"))
+		return
+	}
+
+	sender := instrumentSender(mail.NewGmailSender(emailName, emailAddress, emailPassword, senderOptions...))
+
+	ctx, cancel := context.WithTimeout(r.Context(), emailSendTimeout)
+	defer cancel()
+	slog.InfoContext(ctx, "enviando invitación", "uid", invite.UID, "method", method, "sequence", invite.Sequence)
+	if err := sendInvite(ctx, sender, event, ics); err != nil {
+		slog.ErrorContext(ctx, "error al enviar invitación", "uid", invite.UID, "error", err)
+		http.Error(w, fmt.Sprintf("Error al enviar la invitación: %v", err), sendErrorStatus(err))
+		return
+	}
+
+	if err := invites.Save(invite); err != nil {
+		slog.ErrorContext(ctx, "error al guardar invitación", "uid", invite.UID, "error", err)
+		http.Error(w, "Invitación enviada pero no se pudo guardar", http.StatusInternalServerError)
+		return
+	}
+
+	status := "sent"
+	if invite.Cancelled {
+		status = "cancelled"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(CalendarInviteResponse{UID: invite.UID, Sequence: invite.Sequence, Status: status})
+}
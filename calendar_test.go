@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	netmail "net/mail"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"email-api/mail"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Guarda los mensajes en vez de entregarlos por SMTP
+type recordingTransport struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (t *recordingTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, string(msg))
+	return nil
+}
+
+func (t *recordingTransport) last() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.messages[len(t.messages)-1]
+}
+
+// Configura un remitente que entrega en transport
+func useRecordingSender(t *testing.T) *recordingTransport {
+	t.Helper()
+	t.Setenv("EMAIL_SENDER_NAME", "Tienda")
+	t.Setenv("EMAIL_SENDER_ADDRESS", "agenda@tienda.com")
+	t.Setenv("EMAIL_SENDER_PASSWORD", "secreto")
+	transport := &recordingTransport{}
+	saved := senderOptions
+	t.Cleanup(func() { senderOptions = saved })
+	senderOptions = []mail.Option{mail.WithTransport(transport)}
+	return transport
+}
+
+// Asunto, METHOD y contenido de la parte text/calendar del cuerpo
+func readInvite(t *testing.T, raw string) (subject string, method string, ics string) {
+	t.Helper()
+	msg, err := netmail.ReadMessage(strings.NewReader(raw))
+	require.NoError(t, err)
+	subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	alternative, err := multipart.NewReader(msg.Body, params["boundary"]).NextPart()
+	require.NoError(t, err)
+	_, params, err = mime.ParseMediaType(alternative.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	parts := multipart.NewReader(alternative, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		require.NoError(t, err, "falta la parte text/calendar")
+		mediaType, params, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		if mediaType == "text/calendar" {
+			content, err := io.ReadAll(part)
+			require.NoError(t, err)
+			return subject, params["method"], strings.ReplaceAll(string(content), "\r\n ", "")
+		}
+	}
+}
+
+func TestMergeInvite(t *testing.T) {
+	start := time.Date(2024, time.June, 10, 15, 0, 0, 0, time.UTC)
+	current := CalendarInviteRequest{
+		UID:       "abc@email-api",
+		Summary:   "Demo",
+		Location:  "Oficina",
+		Start:     start,
+		End:       start.Add(time.Hour),
+		Attendees: []Recipient{{Email: "juan@ejemplo.com"}},
+	}
+
+	merged := mergeInvite(current, CalendarInviteRequest{UID: "abc@email-api", Start: start.Add(time.Hour), End: start.Add(2 * time.Hour)})
+	require.Equal(t, "Demo", merged.Summary)
+	require.Equal(t, "Oficina", merged.Location)
+	require.Equal(t, start.Add(time.Hour), merged.Start)
+	require.Equal(t, current.Attendees, merged.Attendees)
+
+	merged = mergeInvite(current, CalendarInviteRequest{Summary: "Demo nueva", Attendees: []Recipient{{Email: "ana@ejemplo.com"}}})
+	require.Equal(t, "Demo nueva", merged.Summary)
+	require.Equal(t, []Recipient{{Email: "ana@ejemplo.com"}}, merged.Attendees)
+	require.Equal(t, current.Start, merged.Start)
+}
+
+func TestCalendarInviteHandler(t *testing.T) {
+	transport := useRecordingSender(t)
+	saved := invites
+	t.Cleanup(func() { invites = saved })
+	var err error
+	invites, err = newInviteStore(filepath.Join(t.TempDir(), "invites.json"))
+	require.NoError(t, err)
+
+	call := func(method string, target string, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		calendarInviteHandler(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	// Crear
+	rec := call(http.MethodPost, "/calendar-invite", `{
+		"summary": "Demo",
+		"start": "2024-06-10T15:00:00Z",
+		"end": "2024-06-10T15:30:00Z",
+		"timezone": "UTC",
+		"attendees": [{"email": "juan@ejemplo.com", "name": "Juan"}]
+	}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created CalendarInviteResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.Equal(t, 0, created.Sequence)
+	require.Equal(t, "sent", created.Status)
+	subject, method, ics := readInvite(t, transport.last())
+	require.Equal(t, "Invitación: Demo", subject)
+	require.Equal(t, "REQUEST", method)
+	require.Contains(t, ics, "UID:"+created.UID)
+
+	// Actualizar: mismo UID y SEQUENCE+1
+	rec = call(http.MethodPut, "/calendar-invite", `{"uid": "`+created.UID+`", "location": "Oficina"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var updated CalendarInviteResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&updated))
+	require.Equal(t, CalendarInviteResponse{UID: created.UID, Sequence: 1, Status: "sent"}, updated)
+	subject, _, ics = readInvite(t, transport.last())
+	require.Equal(t, "Actualizada: Demo", subject)
+	require.Contains(t, ics, "SEQUENCE:1\r\n")
+	require.Contains(t, ics, "LOCATION:Oficina\r\n")
+
+	// Cancelar
+	rec = call(http.MethodDelete, "/calendar-invite?uid="+created.UID, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var cancelled CalendarInviteResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&cancelled))
+	require.Equal(t, CalendarInviteResponse{UID: created.UID, Sequence: 2, Status: "cancelled"}, cancelled)
+	subject, method, ics = readInvite(t, transport.last())
+	require.Equal(t, "Cancelada: Demo", subject)
+	require.Equal(t, "CANCEL", method)
+	require.Contains(t, ics, "SEQUENCE:2\r\n")
+	require.Contains(t, ics, "STATUS:CANCELLED\r\n")
+
+	// Una invitación cancelada ya no se puede cancelar ni actualizar
+	require.Equal(t, http.StatusNotFound, call(http.MethodDelete, "/calendar-invite?uid="+created.UID, "").Code)
+	require.Equal(t, http.StatusNotFound, call(http.MethodPut, "/calendar-invite", `{"uid": "`+created.UID+`"}`).Code)
+	require.Equal(t, http.StatusNotFound, call(http.MethodDelete, "/calendar-invite?uid=no-existe", "").Code)
+	require.Len(t, transport.messages, 3)
+
+	require.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/calendar-invite", `{"summary": "Demo"}`).Code)
+	require.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/calendar-invite", `{`).Code)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"email-api/mail"
+)
+
+// Opciones comunes para todos los remitentes (DKIM, etc.)
+var senderOptions []mail.Option
+
+// Pool de SMTP_POOL_SIZE; nil sin pool. Se cierra al apagar, después de la cola.
+var smtpPool *mail.SMTPPool
+
+// Cargar las claves DKIM desde DKIM_KEYS con el formato dominio:selector:/ruta/clave.pem separadas por coma
+func loadDKIMSigner(config string) (*mail.DKIMSigner, error) {
+	var keys []mail.DKIMKey
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("entrada DKIM inválida %q, se esperaba dominio:selector:ruta", entry)
+		}
+		key, err := mail.LoadDKIMKey(parts[0], parts[1], parts[2])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return mail.NewDKIMSigner(keys...), nil
+}
+
+// Configurar el proveedor SMTP, la autenticación XOAUTH2 y el pool de conexiones
+func loadSMTPOptions() ([]mail.Option, error) {
+	provider, err := mail.ProviderByName(os.Getenv("EMAIL_PROVIDER"))
+	if err != nil {
+		return nil, fmt.Errorf("EMAIL_PROVIDER inválido: %v", err)
+	}
+	server, host := provider.Server, provider.Host
+
+	auth, err := loadXOAuth2(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []mail.Option{mail.WithServer(server)}
+	if auth != nil {
+		opts = append(opts, mail.WithAuth(auth))
+	}
+
+	// Pool de conexiones compartido entre todas las peticiones
+	if size := os.Getenv("SMTP_POOL_SIZE"); size != "" {
+		maxConns, err := strconv.Atoi(size)
+		if err != nil {
+			return nil, fmt.Errorf("SMTP_POOL_SIZE inválido: %v", err)
+		}
+		if auth == nil {
+			auth = smtp.PlainAuth("", os.Getenv("EMAIL_SENDER_ADDRESS"), os.Getenv("EMAIL_SENDER_PASSWORD"), host)
+		}
+		smtpPool = mail.NewSMTPPool(mail.PoolConfig{
+			Addr:        server,
+			Auth:        auth,
+			MaxConns:    maxConns,
+			IdleTimeout: 30 * time.Second,
+		})
+		opts = append(opts, mail.WithTransport(smtpPool))
+	}
+
+	return opts, nil
+}
+
+// Autenticación XOAUTH2 con refresh token; nil si se usa contraseña de aplicación
+func loadXOAuth2(provider mail.Provider) (smtp.Auth, error) {
+	if os.Getenv("EMAIL_AUTH_MECHANISM") != "xoauth2" {
+		return nil, nil
+	}
+
+	tokenURL := os.Getenv("OAUTH2_TOKEN_URL")
+	if tokenURL == "" {
+		tokenURL = provider.TokenURL
+	}
+
+	source := mail.NewRefreshTokenSource(context.Background(), mail.OAuth2Config{
+		ClientID:     os.Getenv("OAUTH2_CLIENT_ID"),
+		ClientSecret: os.Getenv("OAUTH2_CLIENT_SECRET"),
+		RefreshToken: os.Getenv("OAUTH2_REFRESH_TOKEN"),
+		TokenURL:     tokenURL,
+		Scopes:       provider.Scopes,
+	})
+	return mail.XOAuth2Auth(os.Getenv("EMAIL_SENDER_ADDRESS"), source, provider.Host), nil
+}
+
+// Con XOAUTH2 no se necesita contraseña de aplicación
+func emailCredentialsConfigured(password string) bool {
+	return password != "" || os.Getenv("EMAIL_AUTH_MECHANISM") == "xoauth2"
+}
+
+// Remitente configurado con EMAIL_SENDER_*; false si falta la configuración
+func configuredSender() (mail.EmailSender, bool) {
+	address := os.Getenv("EMAIL_SENDER_ADDRESS")
+	password := os.Getenv("EMAIL_SENDER_PASSWORD")
+	if address == "" || !emailCredentialsConfigured(password) {
+		return nil, false
+	}
+	return instrumentSender(mail.NewGmailSender(os.Getenv("EMAIL_SENDER_NAME"), address, password, senderOptions...)), true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+
+	"email-api/mail"
+)
+
+// Formulario de contacto: se entrega al buzón configurado, no al visitante
+type ContactFormRequest struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+}
+
+// Buzón del formulario de contacto; DESTINATION_EMAIL se mantiene por compatibilidad
+func contactFormInbox() string {
+	if inbox := os.Getenv("CONTACT_FORM_INBOX"); inbox != "" {
+		return inbox
+	}
+	return os.Getenv("DESTINATION_EMAIL")
+}
+
+// Decodificar el formulario como JSON o como formulario HTML
+func decodeContactForm(r *http.Request) (ContactFormRequest, error) {
+	var req ContactFormRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		return req, err
+	}
+	// También procesa los formularios urlencoded; los errores de lectura, como
+	// superar el límite del cuerpo, no se ignoran como en FormValue
+	if err := r.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return req, err
+	}
+	req.Name = r.FormValue("name")
+	req.Email = r.FormValue("email")
+	req.Subject = r.FormValue("subject")
+	req.Message = r.FormValue("message")
+	return req, nil
+}
+
+// Cuerpo HTML y texto del mensaje recibido por el formulario
+func contactFormBodies(req ContactFormRequest) (string, string) {
+	htmlBody := fmt.Sprintf(`
+		<h1>%s</h1>
+		<p><strong>Email:</strong> %s</p>
+		<h2>%s</h2>
+		<p>%s</p>
+	`, html.EscapeString(req.Name), html.EscapeString(req.Email), html.EscapeString(req.Subject), html.EscapeString(req.Message))
+	textBody := fmt.Sprintf("%s <%s>\n\n%s\n\n%s", req.Name, req.Email, req.Subject, req.Message)
+	return htmlBody, textBody
+}
+
+// Handler del formulario de contacto
+func contactFormHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeContactForm(r)
+	if err != nil {
+		http.Error(w, "Error al procesar el formulario", bodyErrorStatus(err))
+		return
+	}
+	if req.Email == "" || req.Message == "" {
+		http.Error(w, "email y message son requeridos", http.StatusBadRequest)
+		return
+	}
+	if err := req.checkTextLimits(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Responder al correo del visitante desde el buzón
+	replyTo := &Recipient{Email: req.Email, Name: req.Name}
+	if _, err := replyTo.Address(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Sin buzón es un problema de configuración, no del visitante
+	inbox := contactFormInbox()
+	if inbox == "" {
+		slog.WarnContext(r.Context(), "buzón del formulario no configurado, respondiendo sin enviar")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Mensaje recibido pero no enviado (falta configuración)"))
+		return
+	}
+	recipients, err := resolveRecipients(RecipientFields{ReplyTo: replyTo}, inbox, 1)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "buzón del formulario inválido", "inbox", inbox, "error", err)
+		http.Error(w, "Buzón del formulario mal configurado", http.StatusInternalServerError)
+		return
+	}
+
+	sender, ok := configuredSender()
+	if !ok {
+		slog.WarnContext(r.Context(), "configuración de email no encontrada, respondiendo sin enviar")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Mensaje recibido pero no enviado (falta configuración)"))
+		return
+	}
+
+	subject := req.Subject
+	if subject == "" {
+		subject = "Nuevo mensaje de contacto"
+	}
+	htmlBody, textBody := contactFormBodies(req)
+	msg, err := recipients.Apply(mail.NewMessage()).
+		Subject(subject).
+		HTML(htmlBody).
+		Text(textBody).
+		Tag("contact-form").
+		Build()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Mensaje inválido: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), emailSendTimeout)
+	defer cancel()
+	if err := sender.Send(ctx, msg); err != nil {
+		slog.ErrorContext(r.Context(), "error al enviar el formulario de contacto", "error", err)
+		http.Error(w, fmt.Sprintf("Error al enviar el correo: %v", err), sendErrorStatus(err))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "formulario de contacto enviado")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Mensaje enviado exitosamente"))
+}
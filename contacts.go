@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	netmail "net/mail"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Estado de suscripción de un contacto
+type SubscriptionStatus string
+
+const (
+	StatusSubscribed   SubscriptionStatus = "subscribed"
+	StatusUnsubscribed SubscriptionStatus = "unsubscribed"
+	StatusBounced      SubscriptionStatus = "bounced"
+)
+
+// Contacto de la audiencia
+type Contact struct {
+	Email      string             `json:"email"`
+	Name       string             `json:"name,omitempty"`
+	Locale     string             `json:"locale,omitempty"`
+	TimeZone   string             `json:"timezone,omitempty"`
+	Phone      string             `json:"phone,omitempty"`
+	Attributes map[string]string  `json:"attributes,omitempty"`
+	Tags       []string           `json:"tags,omitempty"`
+	Status     SubscriptionStatus `json:"status"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
+
+var errInvalidContact = errors.New("contacto inválido")
+
+// Normalizar y validar el contacto
+func (c *Contact) normalize() error {
+	if err := c.checkTextLimits(); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidContact, err)
+	}
+	addr, err := netmail.ParseAddress(c.Email)
+	if err != nil {
+		return fmt.Errorf("%w: dirección %q: %v", errInvalidContact, c.Email, err)
+	}
+	c.Email = addr.Address
+	if c.Name == "" {
+		c.Name = addr.Name
+	}
+
+	switch c.Status {
+	case "":
+		c.Status = StatusSubscribed
+	case StatusSubscribed, StatusUnsubscribed, StatusBounced:
+	default:
+		return fmt.Errorf("%w: estado desconocido %q", errInvalidContact, c.Status)
+	}
+
+	if c.TimeZone != "" {
+		if _, err := time.LoadLocation(c.TimeZone); err != nil {
+			return fmt.Errorf("%w: zona horaria %q: %v", errInvalidContact, c.TimeZone, err)
+		}
+	}
+
+	var tags []string
+	for _, tag := range c.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	c.Tags = tags
+	return nil
+}
+
+// Recipient del contacto para armar el mensaje
+func (c Contact) Recipient() Recipient {
+	return Recipient{Email: c.Email, Name: c.Name}
+}
+
+// Filtro de audiencia. Todos los criterios indicados deben cumplirse y el
+// contacto debe tener todas las etiquetas de Tags.
+type ContactFilter struct {
+	All        bool               `json:"all,omitempty"`
+	Tags       []string           `json:"tags,omitempty"`
+	Status     SubscriptionStatus `json:"status,omitempty"`
+	Locale     string             `json:"locale,omitempty"`
+	Attributes map[string]string  `json:"attributes,omitempty"`
+}
+
+// Filtro desde la query: ?tag=vip&status=subscribed&locale=es&attr.plan=pro
+func contactFilterFromQuery(r *http.Request) ContactFilter {
+	query := r.URL.Query()
+	filter := ContactFilter{
+		Tags:   query["tag"],
+		Status: SubscriptionStatus(query.Get("status")),
+		Locale: query.Get("locale"),
+	}
+	for key, values := range query {
+		if name, ok := strings.CutPrefix(key, "attr."); ok && len(values) > 0 {
+			if filter.Attributes == nil {
+				filter.Attributes = make(map[string]string)
+			}
+			filter.Attributes[name] = values[0]
+		}
+	}
+	return filter
+}
+
+// Indica si el filtro tiene algún criterio
+func (f ContactFilter) empty() bool {
+	return len(f.Tags) == 0 && f.Status == "" && f.Locale == "" && len(f.Attributes) == 0
+}
+
+func (f ContactFilter) Match(c Contact) bool {
+	if f.Status != "" && c.Status != f.Status {
+		return false
+	}
+	if f.Locale != "" && !strings.EqualFold(c.Locale, f.Locale) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !slices.Contains(c.Tags, tag) {
+			return false
+		}
+	}
+	for key, value := range f.Attributes {
+		if c.Attributes[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Almacén de contactos en un archivo JSON, indexado por email en minúsculas
+type contactStore struct {
+	mu       sync.Mutex
+	path     string
+	contacts map[string]Contact
+}
+
+var contacts *contactStore
+
+var errContactNotFound = errors.New("contacto no encontrado")
+var errContactExists = errors.New("el contacto ya existe")
+
+func newContactStore(path string) (*contactStore, error) {
+	store := &contactStore{path: path, contacts: make(map[string]Contact)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.contacts); err != nil {
+		return nil, fmt.Errorf("error al leer %s: %v", path, err)
+	}
+	return store, nil
+}
+
+func contactKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Contactos que cumplen el filtro ordenados por email
+func (s *contactStore) List(filter ContactFilter) []Contact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Contact
+	for _, c := range s.contacts {
+		if filter.Match(c) {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return contactKey(list[i].Email) < contactKey(list[j].Email) })
+	return list
+}
+
+func (s *contactStore) Get(email string) (Contact, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.contacts[contactKey(email)]
+	return c, ok
+}
+
+// Crear un contacto nuevo
+func (s *contactStore) Create(c Contact) (Contact, error) {
+	if err := c.normalize(); err != nil {
+		return c, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.contacts[contactKey(c.Email)]; ok {
+		return c, errContactExists
+	}
+	c.CreatedAt = time.Now().UTC()
+	c.UpdatedAt = c.CreatedAt
+	s.contacts[contactKey(c.Email)] = c
+	return c, s.persist()
+}
+
+// Reemplazar un contacto existente manteniendo su fecha de creación
+func (s *contactStore) Update(email string, c Contact) (Contact, error) {
+	if err := c.normalize(); err != nil {
+		return c, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.contacts[contactKey(email)]
+	if !ok {
+		return c, errContactNotFound
+	}
+	if contactKey(c.Email) != contactKey(email) {
+		return c, fmt.Errorf("%w: el email no coincide con la URL", errInvalidContact)
+	}
+	c.CreatedAt = current.CreatedAt
+	c.UpdatedAt = time.Now().UTC()
+	s.contacts[contactKey(c.Email)] = c
+	return c, s.persist()
+}
+
+func (s *contactStore) Delete(email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.contacts[contactKey(email)]; !ok {
+		return errContactNotFound
+	}
+	delete(s.contacts, contactKey(email))
+	return s.persist()
+}
+
+// Importar creando o actualizando contactos; devuelve creados y actualizados
+func (s *contactStore) Import(list []Contact) (int, int, error) {
+	for i := range list {
+		if err := list[i].normalize(); err != nil {
+			return 0, 0, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	created, updated := 0, 0
+	for _, c := range list {
+		key := contactKey(c.Email)
+		if current, ok := s.contacts[key]; ok {
+			c.CreatedAt = current.CreatedAt
+			updated++
+		} else {
+			c.CreatedAt = now
+			created++
+		}
+		c.UpdatedAt = now
+		s.contacts[key] = c
+	}
+	return created, updated, s.persist()
+}
+
+func (s *contactStore) persist() error {
+	return writeJSONFile(s.path, s.contacts)
+}
+
+// Código HTTP para los errores del almacén de contactos
+func contactErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidContact):
+		return http.StatusBadRequest
+	case errors.Is(err, errContactNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errContactExists):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// GET /contacts: lista con filtros
+func listContactsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, contacts.List(contactFilterFromQuery(r)))
+}
+
+// POST /contacts
+func createContactHandler(w http.ResponseWriter, r *http.Request) {
+	var c Contact
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
+		return
+	}
+	created, err := contacts.Create(c)
+	if err != nil {
+		http.Error(w, err.Error(), contactErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// GET /contacts/{email}
+func getContactHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := contacts.Get(r.PathValue("email"))
+	if !ok {
+		http.Error(w, errContactNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// PUT /contacts/{email}
+func updateContactHandler(w http.ResponseWriter, r *http.Request) {
+	email := r.PathValue("email")
+	var c Contact
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
+		return
+	}
+	if c.Email == "" {
+		c.Email = email
+	}
+	updated, err := contacts.Update(email, c)
+	if err != nil {
+		http.Error(w, err.Error(), contactErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DELETE /contacts/{email}
+func deleteContactHandler(w http.ResponseWriter, r *http.Request) {
+	if err := contacts.Delete(r.PathValue("email")); err != nil {
+		http.Error(w, err.Error(), contactErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /contacts/import: CSV en el cuerpo o en el campo "file" de un formulario
+func contactsImportHandler(w http.ResponseWriter, r *http.Request) {
+	body := r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Falta el archivo CSV en el campo file", bodyErrorStatus(err))
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	list, err := parseContactsCSV(body)
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	created, updated, err := contacts.Import(list)
+	if err != nil {
+		http.Error(w, err.Error(), contactErrorStatus(err))
+		return
+	}
+	slog.InfoContext(r.Context(), "contactos importados", "total", len(list), "created", created, "updated", updated)
+	writeJSON(w, http.StatusOK, map[string]int{"created": created, "updated": updated})
+}
+
+// GET /contacts/export: CSV con los contactos que cumplen el filtro
+func contactsExportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="contacts.csv"`)
+	if err := writeContactsCSV(w, contacts.List(contactFilterFromQuery(r))); err != nil {
+		slog.ErrorContext(r.Context(), "error al exportar contactos", "error", err)
+	}
+}
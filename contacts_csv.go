@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Columnas fijas del CSV; el resto se importa como atributos
+var contactCSVColumns = []string{"email", "name", "locale", "timezone", "phone", "tags", "status"}
+
+// Las etiquetas van en una sola columna separadas por ";"
+const contactTagSeparator = ";"
+
+// Leer contactos desde un CSV con cabecera. La columna email es obligatoria.
+func parseContactsCSV(r io.Reader) ([]Contact, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV sin cabecera: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+	if !slices.Contains(header, "email") {
+		return nil, errors.New("el CSV debe tener una columna email")
+	}
+
+	var list []Contact
+	var errs []error
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		// Tras un error de comillas no hay posiciones de campo
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		var c Contact
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			switch header[i] {
+			case "email":
+				c.Email = value
+			case "name":
+				c.Name = value
+			case "locale":
+				c.Locale = value
+			case "timezone":
+				c.TimeZone = value
+			case "phone":
+				c.Phone = value
+			case "tags":
+				c.Tags = strings.Split(value, contactTagSeparator)
+			case "status":
+				c.Status = SubscriptionStatus(value)
+			default:
+				if value == "" {
+					continue
+				}
+				if c.Attributes == nil {
+					c.Attributes = make(map[string]string)
+				}
+				c.Attributes[header[i]] = value
+			}
+		}
+		if err := c.normalize(); err != nil {
+			errs = append(errs, fmt.Errorf("línea %d: %v", line, err))
+			continue
+		}
+		list = append(list, c)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return list, nil
+}
+
+// Escribir los contactos en CSV con una columna por cada atributo usado
+func writeContactsCSV(w io.Writer, list []Contact) error {
+	attributeSet := make(map[string]bool)
+	for _, c := range list {
+		for key := range c.Attributes {
+			attributeSet[key] = true
+		}
+	}
+	var attributes []string
+	for key := range attributeSet {
+		attributes = append(attributes, key)
+	}
+	sort.Strings(attributes)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append(append([]string{}, contactCSVColumns...), attributes...)); err != nil {
+		return err
+	}
+	for _, c := range list {
+		record := []string{c.Email, c.Name, c.Locale, c.TimeZone, c.Phone, strings.Join(c.Tags, contactTagSeparator), string(c.Status)}
+		for _, key := range attributes {
+			record = append(record, c.Attributes[key])
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testContactsCSV = "\ufeffEmail,Name,Locale,Tags,Status,Plan\n" +
+	"juan@ejemplo.com,Juan Pérez,es,vip;invierno,,pro\n" +
+	"Ana <ana@ejemplo.com>,,en,invierno,unsubscribed,\n"
+
+func TestParseContactsCSV(t *testing.T) {
+	list, err := parseContactsCSV(strings.NewReader(testContactsCSV))
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "Juan Pérez", list[0].Name)
+	require.Equal(t, []string{"vip", "invierno"}, list[0].Tags)
+	require.Equal(t, StatusSubscribed, list[0].Status)
+	require.Equal(t, map[string]string{"plan": "pro"}, list[0].Attributes)
+	require.Equal(t, "ana@ejemplo.com", list[1].Email)
+	require.Equal(t, "Ana", list[1].Name)
+	require.Equal(t, StatusUnsubscribed, list[1].Status)
+
+	var out bytes.Buffer
+	require.NoError(t, writeContactsCSV(&out, list))
+	roundTrip, err := parseContactsCSV(&out)
+	require.NoError(t, err)
+	require.Equal(t, list, roundTrip)
+}
+
+func TestParseContactsCSVRejects(t *testing.T) {
+	_, err := parseContactsCSV(strings.NewReader("name\nJuan\n"))
+	require.Error(t, err)
+
+	_, err = parseContactsCSV(strings.NewReader("email,status\nno-es-email,\nana@ejemplo.com,borrado\n"))
+	require.ErrorContains(t, err, "línea 2")
+	require.ErrorContains(t, err, "línea 3")
+
+	// Comillas mal cerradas
+	for _, malformed := range []string{"email,name\n\"a@b.com,x\n", "email\na\"b@c.com\n"} {
+		_, err = parseContactsCSV(strings.NewReader(malformed))
+		require.Error(t, err, malformed)
+	}
+}
+
+func TestContactStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+	store, err := newContactStore(path)
+	require.NoError(t, err)
+
+	created, err := store.Create(Contact{Email: "Juan@Ejemplo.com", Tags: []string{"vip", "vip", " "}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"vip"}, created.Tags)
+	_, err = store.Create(Contact{Email: "juan@ejemplo.com"})
+	require.True(t, errors.Is(err, errContactExists))
+	_, err = store.Create(Contact{Email: "ana@ejemplo.com", TimeZone: "Marte/Olympus"})
+	require.True(t, errors.Is(err, errInvalidContact))
+
+	updated, err := store.Update("juan@ejemplo.com", Contact{Email: "juan@ejemplo.com", Name: "Juan", Locale: "es"})
+	require.NoError(t, err)
+	require.Equal(t, created.CreatedAt, updated.CreatedAt)
+
+	list, err := parseContactsCSV(strings.NewReader(testContactsCSV))
+	require.NoError(t, err)
+	newCount, updatedCount, err := store.Import(list)
+	require.NoError(t, err)
+	require.Equal(t, 1, newCount)
+	require.Equal(t, 1, updatedCount)
+
+	// Los datos se recuperan del archivo
+	reopened, err := newContactStore(path)
+	require.NoError(t, err)
+	require.Len(t, reopened.List(ContactFilter{}), 2)
+	require.Len(t, reopened.List(ContactFilter{Tags: []string{"invierno"}, Status: StatusSubscribed}), 1)
+	require.Len(t, reopened.List(ContactFilter{Attributes: map[string]string{"plan": "pro"}}), 1)
+	require.Empty(t, reopened.List(ContactFilter{Tags: []string{"vip"}, Locale: "en"}))
+
+	require.NoError(t, reopened.Delete("JUAN@ejemplo.com"))
+	require.True(t, errors.Is(reopened.Delete("juan@ejemplo.com"), errContactNotFound))
+}
+
+// Reemplaza el almacén global de contactos por uno temporal
+func useTestContacts(t *testing.T, list ...Contact) {
+	t.Helper()
+	saved := contacts
+	t.Cleanup(func() { contacts = saved })
+	var err error
+	contacts, err = newContactStore(filepath.Join(t.TempDir(), "contacts.json"))
+	require.NoError(t, err)
+	for _, c := range list {
+		_, err := contacts.Create(c)
+		require.NoError(t, err)
+	}
+}
+
+func TestContactsImportHandler(t *testing.T) {
+	useTestContacts(t, Contact{Email: "juan@ejemplo.com", Name: "Juan"})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/contacts/import", strings.NewReader(testContactsCSV))
+	req.Header.Set("Content-Type", "text/csv")
+	contactsImportHandler(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"created": 1, "updated": 1}`, rec.Body.String())
+	juan, ok := contacts.Get("juan@ejemplo.com")
+	require.True(t, ok)
+	require.Equal(t, "Juan Pérez", juan.Name)
+
+	// Como archivo de un formulario
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "contactos.csv")
+	require.NoError(t, err)
+	file.Write([]byte("email\npedro@ejemplo.com\n"))
+	require.NoError(t, form.Close())
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/contacts/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	contactsImportHandler(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `{"created": 1, "updated": 0}`, rec.Body.String())
+
+	for name, csv := range map[string]string{
+		"sin email":         "name\nJuan\n",
+		"email inválido":    "email\nno-es-email\n",
+		"comillas abiertas": "email,name\n\"a@b.com,x\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			contactsImportHandler(rec, httptest.NewRequest(http.MethodPost, "/contacts/import", strings.NewReader(csv)))
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+	require.Len(t, contacts.List(ContactFilter{All: true}), 3)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Catálogos de mensajes y formatos por idioma
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Locale con los textos de las plantillas y el formato de fechas y números
+type Locale struct {
+	Code      string            `json:"-"`
+	Decimal   string            `json:"decimal"`
+	Thousands string            `json:"thousands"`
+	DateShort string            `json:"date_short"`
+	DateLong  string            `json:"date_long"`
+	Months    []string          `json:"months"`
+	Messages  map[string]string `json:"messages"`
+}
+
+// Idioma usado cuando no hay catálogo para el pedido ni para el contacto
+const fallbackLocale = "en"
+
+var locales = mustLoadLocales()
+
+func mustLoadLocales() map[string]*Locale {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]*Locale)
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var loc Locale
+		if err := json.Unmarshal(data, &loc); err != nil {
+			panic(fmt.Sprintf("catálogo %s inválido: %v", entry.Name(), err))
+		}
+		loc.Code = strings.TrimSuffix(entry.Name(), ".json")
+		loaded[loc.Code] = &loc
+	}
+
+	// Los textos que falten en un catálogo se toman del idioma por defecto
+	base := loaded[fallbackLocale]
+	for _, loc := range loaded {
+		for key, text := range base.Messages {
+			if _, ok := loc.Messages[key]; !ok {
+				loc.Messages[key] = text
+			}
+		}
+	}
+	return loaded
+}
+
+// Buscar el catálogo de un código como "es-CL" probando también "es"
+func lookupLocale(code string) (*Locale, bool) {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "_", "-"))
+	if code == "" {
+		return nil, false
+	}
+	if loc, ok := locales[code]; ok {
+		return loc, true
+	}
+	language, _, _ := strings.Cut(code, "-")
+	loc, ok := locales[language]
+	return loc, ok
+}
+
+// Idioma del pedido, luego el del contacto y por último DEFAULT_LOCALE
+func resolveLocale(candidates ...string) *Locale {
+	for _, code := range append(candidates, os.Getenv("DEFAULT_LOCALE")) {
+		if loc, ok := lookupLocale(code); ok {
+			return loc
+		}
+	}
+	return locales[fallbackLocale]
+}
+
+// Locale indicado en los datos de la plantilla con el campo "locale"
+func localeFromData(data map[string]any) *Locale {
+	code, _ := data["locale"].(string)
+	return resolveLocale(code)
+}
+
+// Formatear una fecha; "short" y "long" usan el formato del idioma
+func (loc *Locale) FormatDate(layout string, t time.Time) string {
+	switch layout {
+	case "short":
+		layout = loc.DateShort
+	case "long":
+		layout = loc.DateLong
+	}
+	formatted := t.Format(layout)
+	if len(loc.Months) == 12 && strings.Contains(layout, "January") {
+		formatted = strings.Replace(formatted, t.Month().String(), loc.Months[t.Month()-1], 1)
+	}
+	return formatted
+}
+
+func (loc *Locale) FormatNumber(amount float64, decimals int) string {
+	return formatNumber(amount, decimals, loc.Thousands, loc.Decimal)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveLocale(t *testing.T) {
+	t.Setenv("DEFAULT_LOCALE", "es")
+	require.Equal(t, "en", resolveLocale("en-US", "es").Code)
+	require.Equal(t, "es", resolveLocale("", "es_CL").Code)
+	require.Equal(t, "es", resolveLocale("pt-BR", "").Code)
+
+	t.Setenv("DEFAULT_LOCALE", "")
+	require.Equal(t, fallbackLocale, resolveLocale("pt-BR").Code)
+}
+
+func TestLocaleFormatting(t *testing.T) {
+	data := map[string]any{"locale": "es", "total": 1234567.891, "entrega": "2024-06-10"}
+	tests := map[string]string{
+		`{{.total | currency "CLP"}}`:   "$1.234.568",
+		`{{.total | currency "EUR"}}`:   "€1.234.567,89",
+		`{{.total | number 1}}`:         "1.234.567,9",
+		`{{.entrega | date "short"}}`:   "10/06/2024",
+		`{{.entrega | date "long"}}`:    "10 de junio de 2024",
+		`{{.entrega | date "January"}}`: "junio",
+	}
+	for source, want := range tests {
+		got, err := renderText("test", source, data)
+		require.NoError(t, err, source)
+		require.Equal(t, want, got, source)
+	}
+
+	data["locale"] = "en"
+	got, err := renderText("test", `{{.entrega | date "long"}} {{.total | currency "USD"}}`, data)
+	require.NoError(t, err)
+	require.Equal(t, "June 10, 2024 US$1,234,567.89", got)
+}
+
+func TestRecommendationTemplateLocale(t *testing.T) {
+	contact := &Contact{Email: "juan@ejemplo.com", Name: "Juan", Locale: "es-CL"}
+	products := []Product{{Name: "Auriculares", BuyURL: "https://tienda.com/a"}}
+
+	data, err := recommendationData(RecommendationRequest{Products: products}, contact)
+	require.NoError(t, err)
+	html, err := generateRecommendationHTML(data)
+	require.NoError(t, err)
+	require.Contains(t, html, `<html lang="es">`)
+	require.Contains(t, html, "Hola, Juan")
+	require.Contains(t, html, "COMPRAR")
+	require.NotContains(t, html, "BUY NOW")
+
+	// El idioma del pedido tiene prioridad sobre el del contacto
+	data, err = recommendationData(RecommendationRequest{Products: products, Locale: "en"}, contact)
+	require.NoError(t, err)
+	html, err = generateRecommendationHTML(data)
+	require.NoError(t, err)
+	require.Contains(t, html, "Hello, Juan")
+	require.Contains(t, html, "BUY NOW")
+
+	for code, loc := range locales {
+		require.NotEmpty(t, loc.Decimal, code)
+		require.NotEmpty(t, loc.DateShort, code)
+		require.NotEmpty(t, loc.DateLong, code)
+	}
+}
+
+func TestSendRecommendationUsesContactLocale(t *testing.T) {
+	t.Setenv("DEFAULT_LOCALE", "es")
+	transport := useRecordingSender(t)
+	useTestContacts(t, Contact{Email: "john@ejemplo.com", Name: "John", Locale: "en"})
+
+	rec := httptest.NewRecorder()
+	sendRecommendationHandler(rec, httptest.NewRequest(http.MethodPost, "/send-recommendation", strings.NewReader(`{
+		"subject": "Novedades",
+		"destination_email": "John@ejemplo.com",
+		"products": [{"name": "Auriculares", "buy_url": "https://tienda.com/a"}]
+	}`)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	sent := transport.last()
+	require.Contains(t, sent, "BUY NOW")
+	require.NotContains(t, sent, "COMPRAR")
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"email-api/mail"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Ancho útil de la tarjeta de producto: 600px del contenedor menos los
+// paddings del contenido (20px) y de la tarjeta (25px + 2px de borde)
+const productCardWidth = 506
+
+// Formatos de imagen que se pueden decodificar y redimensionar
+var supportedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Descarga, redimensiona y cachea en disco las imágenes de productos
+type imageFetcher struct {
+	client   *http.Client
+	maxBytes int64
+	// Ancho por alto máximo; un PNG pequeño puede declarar miles de
+	// megapíxeles y decodificarlo reservaría varios GB
+	maxPixels int64
+	width     int
+	cacheDir  string
+	cacheTTL  time.Duration
+}
+
+var productImageFetcher *imageFetcher
+
+// Configuración desde IMAGE_FETCH_TIMEOUT, IMAGE_MAX_BYTES, IMAGE_MAX_PIXELS,
+// IMAGE_CACHE_DIR e IMAGE_CACHE_TTL
+func newImageFetcherFromEnv() *imageFetcher {
+	timeout, err := time.ParseDuration(os.Getenv("IMAGE_FETCH_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	cacheDir := os.Getenv("IMAGE_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "email-api-images")
+	}
+	return &imageFetcher{
+		client:    newImageClient(timeout),
+		maxBytes:  envInt64("IMAGE_MAX_BYTES", 5<<20),
+		maxPixels: envInt64("IMAGE_MAX_PIXELS", 25_000_000),
+		width:     productCardWidth,
+		cacheDir:  cacheDir,
+		cacheTTL:  envDuration("IMAGE_CACHE_TTL", 24*time.Hour),
+	}
+}
+
+// Cliente para las URLs que envía el llamador. Se conecta solo a direcciones
+// públicas; el chequeo va en el dialer para cubrir también las redirecciones
+// y los nombres que resuelven a una IP interna.
+func newImageClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: publicAddressOnly}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("dirección no permitida para descargar imágenes: %s", ip)
+	}
+	return nil
+}
+
+// Fetch devuelve la imagen lista para incrustar y su content-type
+func (f *imageFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", url, f.width)))
+	cachePath := filepath.Join(f.cacheDir, hex.EncodeToString(key[:]))
+
+	// Pasado IMAGE_CACHE_TTL se descarga de nuevo por si la imagen cambió
+	for _, ext := range []string{".jpg", ".png"} {
+		info, err := os.Stat(cachePath + ext)
+		if err != nil || time.Since(info.ModTime()) > f.cacheTTL {
+			continue
+		}
+		if content, err := os.ReadFile(cachePath + ext); err == nil {
+			return content, mime.TypeByExtension(ext), nil
+		}
+	}
+
+	original, err := f.download(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	content, contentType, err := f.resize(original)
+	if err != nil {
+		return nil, "", fmt.Errorf("error procesando %s: %v", url, err)
+	}
+
+	ext := ".jpg"
+	if contentType == "image/png" {
+		ext = ".png"
+	}
+	if err := f.store(cachePath+ext, content); err != nil {
+		slog.WarnContext(ctx, "no se pudo guardar la imagen en caché", "error", err)
+	}
+
+	return content, contentType, nil
+}
+
+// Escribir y renombrar para que otra petición no lea un archivo a medias
+func (f *imageFetcher) store(path string, content []byte) error {
+	if err := os.MkdirAll(f.cacheDir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(f.cacheDir, "download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *imageFetcher) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("%s no es una URL http(s)", url)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s respondió con código: %d", url, resp.StatusCode)
+	}
+	declared, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !supportedImageTypes[declared] {
+		return nil, fmt.Errorf("%s no es una imagen soportada (%s)", url, declared)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return nil, fmt.Errorf("%s supera %d bytes", url, f.maxBytes)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > f.maxBytes {
+		return nil, fmt.Errorf("%s supera %d bytes", url, f.maxBytes)
+	}
+	return content, nil
+}
+
+// Redimensionar al ancho de la tarjeta. Las imágenes con transparencia se
+// mantienen en PNG y el resto se codifica como JPEG.
+func (f *imageFetcher) resize(content []byte) ([]byte, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(config.Width)*int64(config.Height) > f.maxPixels {
+		return nil, "", fmt.Errorf("imagen de %dx%d supera %d píxeles", config.Width, config.Height, f.maxPixels)
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", err
+	}
+
+	bounds := src.Bounds()
+	dst := src
+	if bounds.Dx() > f.width {
+		height := bounds.Dy() * f.width / bounds.Dx()
+		scaled := image.NewRGBA(image.Rect(0, 0, f.width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), src, bounds, draw.Over, nil)
+		dst = scaled
+	}
+
+	var out bytes.Buffer
+	if format == "png" || format == "gif" {
+		if err := png.Encode(&out, dst); err != nil {
+			return nil, "", err
+		}
+		return out.Bytes(), "image/png", nil
+	}
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, "", err
+	}
+	return out.Bytes(), "image/jpeg", nil
+}
+
+// Reemplazar las imágenes remotas de los productos por partes inline
+// referenciadas con cid:. Si una imagen no se puede obtener se deja la URL remota.
+func embedProductImages(ctx context.Context, fetcher *imageFetcher, products []Product) ([]Product, []mail.Attachment) {
+	embedded := make([]Product, len(products))
+	copy(embedded, products)
+
+	var attachments []mail.Attachment
+	cids := make(map[string]string)
+	for i, product := range embedded {
+		if product.Image == "" {
+			continue
+		}
+		if cid, ok := cids[product.Image]; ok {
+			embedded[i].Image = "cid:" + cid
+			continue
+		}
+
+		content, contentType, err := fetcher.Fetch(ctx, product.Image)
+		if err != nil {
+			slog.WarnContext(ctx, "no se pudo incrustar la imagen", "product", product.Name, "error", err)
+			continue
+		}
+
+		cid := fmt.Sprintf("product-%d", len(attachments))
+		filename := cid + ".jpg"
+		if contentType == "image/png" {
+			filename = cid + ".png"
+		}
+		attachments = append(attachments, mail.Attachment{
+			Filename:    filename,
+			ContentType: contentType,
+			Content:     content,
+			Inline:      true,
+			ContentID:   cid,
+		})
+		cids[product.Image] = cid
+		embedded[i].Image = "cid:" + cid
+	}
+	return embedded, attachments
+}
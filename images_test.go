@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestImageServer(t *testing.T, hits *int32) *httptest.Server {
+	img := image.NewRGBA(image.Rect(0, 0, 1200, 600))
+	for x := 0; x < 1200; x++ {
+		img.Set(x, 300, color.RGBA{R: 255, A: 255})
+	}
+	var photo bytes.Buffer
+	require.NoError(t, jpeg.Encode(&photo, img, nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/foto.jpg", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(photo.Bytes())
+	})
+	mux.HandleFunc("/pagina", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/enorme.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(make([]byte, 4096))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestImageFetcher(t *testing.T) *imageFetcher {
+	return &imageFetcher{
+		client:    &http.Client{Timeout: time.Second},
+		maxBytes:  1 << 20,
+		maxPixels: 1 << 20,
+		width:     productCardWidth,
+		cacheDir:  t.TempDir(),
+		cacheTTL:  time.Hour,
+	}
+}
+
+func TestImageFetcherResizesAndCaches(t *testing.T) {
+	var hits int32
+	server := newTestImageServer(t, &hits)
+	fetcher := newTestImageFetcher(t)
+
+	for i := 0; i < 2; i++ {
+		content, contentType, err := fetcher.Fetch(context.Background(), server.URL+"/foto.jpg")
+		require.NoError(t, err)
+		require.Equal(t, "image/jpeg", contentType)
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(content))
+		require.NoError(t, err)
+		require.Equal(t, productCardWidth, config.Width)
+		require.Equal(t, 253, config.Height)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	// Vencida la caché se descarga de nuevo
+	files, err := filepath.Glob(filepath.Join(fetcher.cacheDir, "*.jpg"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(files[0], old, old))
+	_, _, err = fetcher.Fetch(context.Background(), server.URL+"/foto.jpg")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestImageFetcherRejects(t *testing.T) {
+	var hits int32
+	server := newTestImageServer(t, &hits)
+	fetcher := newTestImageFetcher(t)
+	fetcher.maxBytes = 1024
+
+	for _, url := range []string{server.URL + "/pagina", server.URL + "/enorme.jpg", server.URL + "/no-existe", "file:///etc/passwd"} {
+		_, _, err := fetcher.Fetch(context.Background(), url)
+		require.Error(t, err, url)
+	}
+
+	// 1200x600 supera el máximo de píxeles
+	fetcher.maxBytes = 1 << 20
+	fetcher.maxPixels = 500_000
+	_, _, err := fetcher.Fetch(context.Background(), server.URL+"/foto.jpg")
+	require.ErrorContains(t, err, "píxeles")
+}
+
+func TestImageClientRejectsInternalAddresses(t *testing.T) {
+	var hits int32
+	server := newTestImageServer(t, &hits)
+	fetcher := newTestImageFetcher(t)
+	fetcher.client = newImageClient(time.Second)
+
+	_, _, err := fetcher.Fetch(context.Background(), server.URL+"/foto.jpg")
+	require.ErrorContains(t, err, "no permitida")
+	require.Zero(t, atomic.LoadInt32(&hits))
+
+	for _, address := range []string{"127.0.0.1:80", "10.0.0.5:80", "192.168.1.1:443", "169.254.169.254:80", "[::1]:80", "[fe80::1]:80", "[::ffff:127.0.0.1]:80"} {
+		require.Error(t, publicAddressOnly("tcp", address, nil), address)
+	}
+	require.NoError(t, publicAddressOnly("tcp", "93.184.216.34:443", nil))
+}
+
+func TestEmbedProductImages(t *testing.T) {
+	var hits int32
+	server := newTestImageServer(t, &hits)
+
+	products := []Product{
+		{Name: "Auriculares", Image: server.URL + "/foto.jpg"},
+		{Name: "Repetido", Image: server.URL + "/foto.jpg"},
+		{Name: "Roto", Image: server.URL + "/pagina"},
+		{Name: "Sin imagen"},
+	}
+	embedded, attachments := embedProductImages(context.Background(), newTestImageFetcher(t), products)
+
+	require.Len(t, attachments, 1)
+	require.Equal(t, "product-0", attachments[0].ContentID)
+	require.True(t, attachments[0].Inline)
+	require.Equal(t, "cid:product-0", embedded[0].Image)
+	require.Equal(t, "cid:product-0", embedded[1].Image)
+	require.Equal(t, server.URL+"/pagina", embedded[2].Image)
+	require.Empty(t, embedded[3].Image)
+	require.Equal(t, server.URL+"/foto.jpg", products[0].Image)
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Declaración "propiedad: valor" de una regla o de un atributo style
+type cssDeclaration struct {
+	Property  string
+	Value     string
+	Important bool
+}
+
+type cssRule struct {
+	Selector     string
+	Declarations []cssDeclaration
+}
+
+// Hoja de estilos de un bloque <style>. Los bloques @media, @font-face, etc.
+// se guardan sin procesar para devolverlos al <head>.
+type styleSheet struct {
+	Rules   []cssRule
+	AtRules []string
+}
+
+var cssCommentPattern = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+func parseStyleSheet(css string) styleSheet {
+	css = cssCommentPattern.ReplaceAllString(css, "")
+	var sheet styleSheet
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			return sheet
+		}
+		if strings.HasPrefix(css, "@") {
+			end := atRuleEnd(css)
+			sheet.AtRules = append(sheet.AtRules, strings.TrimSpace(css[:end]))
+			css = css[end:]
+			continue
+		}
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return sheet
+		}
+		end := blockEnd(css, open)
+		declarations := parseDeclarations(css[open+1 : end-1])
+		for _, selector := range strings.Split(css[:open], ",") {
+			if selector = strings.Join(strings.Fields(selector), " "); selector != "" {
+				sheet.Rules = append(sheet.Rules, cssRule{Selector: selector, Declarations: declarations})
+			}
+		}
+		css = css[end:]
+	}
+}
+
+// Fin de un bloque @: hasta el ";" de @import o hasta la llave que cierra
+func atRuleEnd(css string) int {
+	for i := 0; i < len(css); i++ {
+		switch css[i] {
+		case ';':
+			return i + 1
+		case '{':
+			return blockEnd(css, i)
+		}
+	}
+	return len(css)
+}
+
+// Posición siguiente a la llave que cierra la que abre en open
+func blockEnd(css string, open int) int {
+	depth := 0
+	for i := open; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(css)
+}
+
+// Separar las declaraciones respetando comillas y paréntesis, por ejemplo en
+// url(data:image/png;base64,...) o font-family: 'Segoe UI'
+func parseDeclarations(block string) []cssDeclaration {
+	var declarations []cssDeclaration
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i <= len(block); i++ {
+		if i < len(block) {
+			c := block[i]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+				continue
+			case c == '"' || c == '\'':
+				quote = c
+				continue
+			case c == '(':
+				depth++
+				continue
+			case c == ')':
+				depth--
+				continue
+			case c != ';' || depth > 0:
+				continue
+			}
+		}
+		property, value, ok := strings.Cut(block[start:i], ":")
+		start = i + 1
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if !ok || property == "" || value == "" {
+			continue
+		}
+		important := false
+		if idx := strings.Index(strings.ToLower(value), "!important"); idx >= 0 {
+			important = true
+			value = strings.TrimSpace(value[:idx])
+		}
+		declarations = append(declarations, cssDeclaration{Property: property, Value: value, Important: important})
+	}
+	return declarations
+}
+
+// Regla con todas sus declaraciones !important, para que gane a los style
+// incrustados; sin esto :hover y @media no se aplicarían nunca
+func importantRule(rule cssRule) string {
+	important := make([]cssDeclaration, len(rule.Declarations))
+	for i, d := range rule.Declarations {
+		important[i] = cssDeclaration{Property: d.Property, Value: d.Value + " !important"}
+	}
+	return rule.Selector + " { " + formatDeclarations(important) + " }"
+}
+
+// Bloque @media con sus reglas marcadas !important. El resto de los bloques
+// @ (@font-face, @import, @keyframes) se devuelven sin cambios.
+func importantMediaRule(atRule string) string {
+	open := strings.IndexByte(atRule, '{')
+	if open < 0 || !strings.HasPrefix(strings.ToLower(atRule), "@media") {
+		return atRule
+	}
+	end := blockEnd(atRule, open)
+	inner := parseStyleSheet(atRule[open+1 : end-1])
+	var parts []string
+	for _, rule := range inner.Rules {
+		parts = append(parts, importantRule(rule))
+	}
+	for _, nested := range inner.AtRules {
+		parts = append(parts, importantMediaRule(nested))
+	}
+	return strings.TrimSpace(atRule[:open]) + " { " + strings.Join(parts, " ") + " }"
+}
+
+func formatDeclarations(declarations []cssDeclaration) string {
+	parts := make([]string, len(declarations))
+	for i, d := range declarations {
+		parts[i] = d.Property + ": " + d.Value
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Parte de un selector sin combinadores, como "a.buy-btn" o "#header"
+type compoundSelector struct {
+	Tag     string
+	ID      string
+	Classes []string
+	Attrs   [][2]string
+	// true si se une a la parte anterior con ">" en vez de un espacio
+	Child bool
+}
+
+type selector struct {
+	Parts       []compoundSelector
+	Specificity int
+}
+
+var compoundPattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9-]*|\*)?((?:[.#][a-zA-Z0-9_-]+|\[[a-zA-Z-]+(?:="?[^"\]]*"?)?\])*)$`)
+var simplePattern = regexp.MustCompile(`[.#][a-zA-Z0-9_-]+|\[[^\]]+\]`)
+
+// Límites del HTML y los selectores que se incrustan; el HTML de /v2/send
+// viene del cliente
+const (
+	maxSelectorParts = 16
+	maxInlineDepth   = 128
+)
+
+// Compilar un selector; los que usan pseudo-clases (:hover), combinadores
+// de hermanos o más de maxSelectorParts partes no se pueden incrustar y
+// devuelven false
+func compileSelector(raw string) (selector, bool) {
+	var sel selector
+	child := false
+	for _, token := range strings.Fields(strings.ReplaceAll(raw, ">", " > ")) {
+		if len(sel.Parts) == maxSelectorParts {
+			return sel, false
+		}
+		if token == ">" {
+			child = true
+			continue
+		}
+		m := compoundPattern.FindStringSubmatch(token)
+		if m == nil {
+			return sel, false
+		}
+		part := compoundSelector{Tag: strings.ToLower(m[1]), Child: child}
+		if part.Tag == "*" {
+			part.Tag = ""
+		} else if part.Tag != "" {
+			sel.Specificity++
+		}
+		for _, simple := range simplePattern.FindAllString(m[2], -1) {
+			switch simple[0] {
+			case '#':
+				part.ID = simple[1:]
+				sel.Specificity += 10000
+			case '.':
+				part.Classes = append(part.Classes, simple[1:])
+				sel.Specificity += 100
+			case '[':
+				name, value, _ := strings.Cut(strings.Trim(simple, "[]"), "=")
+				part.Attrs = append(part.Attrs, [2]string{strings.ToLower(name), strings.Trim(value, `"`)})
+				sel.Specificity += 100
+			}
+		}
+		sel.Parts = append(sel.Parts, part)
+		child = false
+	}
+	return sel, len(sel.Parts) > 0 && !child
+}
+
+func attr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func setAttr(n *html.Node, name string, value string) {
+	for i, a := range n.Attr {
+		if a.Key == name {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: name, Val: value})
+}
+
+func (c compoundSelector) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode || (c.Tag != "" && n.Data != c.Tag) {
+		return false
+	}
+	if c.ID != "" {
+		if id, _ := attr(n, "id"); id != c.ID {
+			return false
+		}
+	}
+	classes, _ := attr(n, "class")
+	for _, class := range c.Classes {
+		if !slices.Contains(strings.Fields(classes), class) {
+			return false
+		}
+	}
+	for _, a := range c.Attrs {
+		value, ok := attr(n, a[0])
+		if !ok || (a[1] != "" && value != a[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+type matchKey struct {
+	node *html.Node
+	part int
+}
+
+// Comparador del selector contra los elementos de un documento. La parte i
+// debe coincidir con el elemento y las anteriores con sus ancestros, o con el
+// padre directo si se unen con ">". Cada (nodo, parte) se resuelve una sola
+// vez: sin memoria los combinadores de descendiente recorren todas las
+// combinaciones de ancestros y el tiempo crece exponencialmente.
+func (s selector) matcher() func(*html.Node) bool {
+	memo := make(map[matchKey]bool)
+	var match func(n *html.Node, part int) bool
+	match = func(n *html.Node, part int) bool {
+		key := matchKey{n, part}
+		if result, ok := memo[key]; ok {
+			return result
+		}
+		current := s.Parts[part]
+		result := current.matches(n)
+		if result && part > 0 {
+			result = false
+			for parent := n.Parent; parent != nil; parent = parent.Parent {
+				if match(parent, part-1) {
+					result = true
+					break
+				}
+				if current.Child {
+					break
+				}
+			}
+		}
+		memo[key] = result
+		return result
+	}
+	return func(n *html.Node) bool {
+		return match(n, len(s.Parts)-1)
+	}
+}
+
+// Propiedades que algún cliente de correo ignora. La clave es la propiedad o
+// "propiedad:valor" cuando solo falla un valor concreto.
+var unsupportedCSS = map[string][]string{
+	"display:flex":          {"outlook"},
+	"display:inline-flex":   {"outlook"},
+	"display:grid":          {"outlook", "gmail", "yahoo"},
+	"align-items":           {"outlook"},
+	"justify-content":       {"outlook"},
+	"flex":                  {"outlook"},
+	"flex-direction":        {"outlook"},
+	"flex-wrap":             {"outlook"},
+	"gap":                   {"outlook", "gmail"},
+	"grid-template-columns": {"outlook", "gmail", "yahoo"},
+	"position":              {"outlook", "gmail", "yahoo"},
+	"transition":            {"outlook", "gmail", "yahoo"},
+	"animation":             {"outlook", "gmail", "yahoo"},
+	"transform":             {"outlook", "gmail", "yahoo"},
+	"object-fit":            {"outlook", "gmail", "yahoo"},
+	"box-shadow":            {"outlook"},
+	"border-radius":         {"outlook"},
+	"opacity":               {"outlook"},
+	"background-image":      {"outlook"},
+	"cursor":                {"outlook", "gmail", "yahoo"},
+}
+
+// Clave de unsupportedCSS que aplica a la declaración, o "" si ninguna
+func unsupportedKey(d cssDeclaration) string {
+	if key := d.Property + ":" + strings.ToLower(d.Value); unsupportedCSS[key] != nil {
+		return key
+	}
+	if unsupportedCSS[d.Property] != nil {
+		return d.Property
+	}
+	return ""
+}
+
+// Clientes que no soportan una declaración, o nil si todos la soportan
+func unsupportedClients(d cssDeclaration) []string {
+	return unsupportedCSS[unsupportedKey(d)]
+}
+
+// Clave de los avisos de selectores que quedan en <head>; el resto usa la
+// clave de unsupportedCSS
+const keptSelectorWarning = "selector"
+
+// Conjunto de avisos sin repetidos y en orden de aparición. keys guarda la
+// regla de cada aviso, que no depende del HTML del pedido.
+type cssWarnings struct {
+	seen map[string]bool
+	list []string
+	keys []string
+}
+
+func (w *cssWarnings) add(key string, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if w.seen == nil {
+		w.seen = map[string]bool{}
+	}
+	if !w.seen[msg] {
+		w.seen[msg] = true
+		w.list = append(w.list, msg)
+		w.keys = append(w.keys, key)
+	}
+}
+
+func (w *cssWarnings) checkDeclarations(where string, declarations []cssDeclaration) {
+	for _, d := range declarations {
+		if key := unsupportedKey(d); key != "" {
+			w.add(key, "%s: %s: %s no funciona en %s", where, d.Property, d.Value, strings.Join(unsupportedCSS[key], ", "))
+		}
+	}
+}
+
+// Declaración candidata para un elemento, ordenada por la cascada
+type matchedDeclaration struct {
+	cssDeclaration
+	specificity int
+	order       int
+}
+
+// Copiar las reglas de los <style> al atributo style de cada elemento, como
+// necesitan Gmail y Outlook. Las reglas que no se pueden incrustar (@media,
+// :hover) quedan en un único <style> del <head>. Devuelve también los avisos
+// de propiedades que algunos clientes no soportan.
+func inlineCSS(document string) (string, []string, error) {
+	inlined, warnings, err := inlineDocument(document)
+	return inlined, warnings.list, err
+}
+
+// Como inlineCSS, con la regla de cada aviso para registrarlo una sola vez
+func inlineDocument(document string) (string, cssWarnings, error) {
+	var warnings cssWarnings
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", warnings, err
+	}
+
+	var styles []*html.Node
+	var head *html.Node
+	var elements []*html.Node
+	tooDeep := false
+	var walk func(*html.Node, int)
+	walk = func(n *html.Node, depth int) {
+		if depth > maxInlineDepth {
+			tooDeep = true
+			return
+		}
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Style:
+				styles = append(styles, n)
+				return
+			case atom.Head:
+				head = n
+			}
+			elements = append(elements, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, depth+1)
+		}
+	}
+	walk(doc, 0)
+	if tooDeep {
+		return "", warnings, fmt.Errorf("el HTML supera %d niveles de anidamiento", maxInlineDepth)
+	}
+	if len(styles) == 0 {
+		return document, warnings, nil
+	}
+
+	var kept []string
+	matched := make(map[*html.Node][]matchedDeclaration)
+	order := 0
+	for _, style := range styles {
+		var css strings.Builder
+		for c := style.FirstChild; c != nil; c = c.NextSibling {
+			css.WriteString(c.Data)
+		}
+		style.Parent.RemoveChild(style)
+
+		sheet := parseStyleSheet(css.String())
+		for _, rule := range sheet.Rules {
+			warnings.checkDeclarations(rule.Selector, rule.Declarations)
+			sel, ok := compileSelector(rule.Selector)
+			if !ok {
+				warnings.add(keptSelectorWarning, "%s: el selector no se puede incrustar y se mantiene en <head>", rule.Selector)
+				kept = append(kept, importantRule(rule))
+				continue
+			}
+			matches := sel.matcher()
+			for _, n := range elements {
+				if !matches(n) {
+					continue
+				}
+				for _, d := range rule.Declarations {
+					matched[n] = append(matched[n], matchedDeclaration{d, sel.Specificity, order})
+					order++
+				}
+			}
+		}
+		for _, atRule := range sheet.AtRules {
+			kept = append(kept, importantMediaRule(atRule))
+		}
+	}
+
+	for _, n := range elements {
+		// El style propio del elemento gana a las reglas salvo !important
+		if inline, ok := attr(n, "style"); ok {
+			declarations := parseDeclarations(inline)
+			warnings.checkDeclarations("<"+n.Data+" style>", declarations)
+			for _, d := range declarations {
+				matched[n] = append(matched[n], matchedDeclaration{d, 1 << 30, order})
+				order++
+			}
+		}
+		if len(matched[n]) == 0 {
+			continue
+		}
+		setAttr(n, "style", formatDeclarations(cascade(matched[n])))
+	}
+
+	if len(kept) > 0 && head != nil {
+		style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: "\n" + strings.Join(kept, "\n") + "\n"})
+		head.AppendChild(style)
+	}
+
+	var out bytes.Buffer
+	if err := html.Render(&out, doc); err != nil {
+		return "", warnings, err
+	}
+	return out.String(), warnings, nil
+}
+
+// Resolver la cascada: !important, luego especificidad y luego el orden. Cada
+// propiedad queda en la posición de su primera aparición.
+func cascade(candidates []matchedDeclaration) []cssDeclaration {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Important != b.Important {
+			return !a.Important
+		}
+		if a.specificity != b.specificity {
+			return a.specificity < b.specificity
+		}
+		return a.order < b.order
+	})
+	index := make(map[string]int)
+	var result []cssDeclaration
+	for _, c := range candidates {
+		d := cssDeclaration{Property: c.Property, Value: c.Value}
+		if i, ok := index[c.Property]; ok {
+			result[i] = d
+			continue
+		}
+		index[c.Property] = len(result)
+		result = append(result, d)
+	}
+	return result
+}
+
+// Reglas ya avisadas; las plantillas se repiten en cada envío y en los lotes.
+// La clave es la propiedad o el tipo de aviso, nunca el texto con los
+// selectores y valores del pedido, para que el mapa no crezca sin límite.
+var loggedCSSWarnings sync.Map
+
+// Paso final antes de enviar: incrustar el CSS salvo con INLINE_CSS=false.
+// Si el HTML no se puede procesar se envía tal cual.
+func prepareEmailHTML(document string) string {
+	if document == "" || os.Getenv("INLINE_CSS") == "false" {
+		return document
+	}
+	inlined, warnings, err := inlineDocument(document)
+	if err != nil {
+		slog.Warn("no se pudo incrustar el CSS", "error", err)
+		return document
+	}
+	for i, warning := range warnings.list {
+		if _, logged := loggedCSSWarnings.LoadOrStore(warnings.keys[i], true); !logged {
+			slog.Warn("CSS no compatible", "rule", warnings.keys[i], "warning", warning)
+		}
+	}
+	return inlined
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDeclarations(t *testing.T) {
+	declarations := parseDeclarations(`font-family: 'Segoe; UI', sans-serif; background: url(data:image/png;base64,AA==); color: red !important;`)
+	require.Equal(t, []cssDeclaration{
+		{Property: "font-family", Value: `'Segoe; UI', sans-serif`},
+		{Property: "background", Value: "url(data:image/png;base64,AA==)"},
+		{Property: "color", Value: "red", Important: true},
+	}, declarations)
+}
+
+func TestInlineCSS(t *testing.T) {
+	document := `<html><head><style>
+		/* reglas del correo */
+		p { color: #333; font-size: 14px; }
+		.card p { color: #000; }
+		#intro { margin: 0; }
+		.card > .btn, a.btn { padding: 10px; border-radius: 4px; }
+		.btn:hover { opacity: 0.8; }
+		.box { display: flex; }
+		@media (max-width: 600px) { .card { padding: 0; } }
+	</style></head><body>
+		<p id="intro">Hola</p>
+		<div class="card box"><p style="font-size: 16px">Texto</p><a class="btn" href="#">Comprar</a></div>
+	</body></html>`
+
+	out, warnings, err := inlineCSS(document)
+	require.NoError(t, err)
+
+	// La regla más específica gana y el style propio gana a todas
+	require.Contains(t, out, `<p id="intro" style="color: #333; font-size: 14px; margin: 0">`)
+	require.Contains(t, out, `<p style="color: #000; font-size: 16px">`)
+	require.Contains(t, out, `<a class="btn" href="#" style="padding: 10px; border-radius: 4px">`)
+	require.Contains(t, out, `<div class="card box" style="display: flex">`)
+
+	// Lo que no se puede incrustar queda en un único <style>
+	require.Equal(t, 1, strings.Count(out, "<style>"))
+	require.Contains(t, out, ".btn:hover { opacity: 0.8 !important }")
+	// Las reglas responsive ganan al style incrustado
+	require.Contains(t, out, "@media (max-width: 600px) { .card { padding: 0 !important } }")
+	require.NotContains(t, out, "reglas del correo")
+
+	require.Contains(t, warnings, ".box: display: flex no funciona en outlook")
+	require.Contains(t, warnings, ".btn:hover: el selector no se puede incrustar y se mantiene en <head>")
+	require.Contains(t, warnings, ".card > .btn: border-radius: 4px no funciona en outlook")
+}
+
+func TestInlineCSSResponsive(t *testing.T) {
+	document := `<style>
+		.card { width: 600px; }
+		@media only screen and (max-width: 600px) { .card { width: 100%; padding: 0 !important; } }
+		@font-face { font-family: Marca; src: url(marca.woff); }
+	</style><div class="card">Hola</div>`
+
+	out, _, err := inlineCSS(document)
+	require.NoError(t, err)
+	require.Contains(t, out, `<div class="card" style="width: 600px">`)
+	require.Contains(t, out, "@media only screen and (max-width: 600px) { .card { width: 100% !important; padding: 0 !important } }")
+	require.Contains(t, out, "@font-face { font-family: Marca; src: url(marca.woff); }")
+}
+
+func TestInlineCSSDeepTree(t *testing.T) {
+	// Sin memoria este selector tardaba segundos con 60 niveles
+	deep := func(levels int) string {
+		return "<style>span div div div div div div p { color: red; }</style>" +
+			strings.Repeat("<div>", levels) + "<p>Hola</p>" + strings.Repeat("</div>", levels)
+	}
+	start := time.Now()
+	out, _, err := inlineCSS(deep(maxInlineDepth - 10))
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.Contains(t, out, "<p>Hola</p>")
+
+	_, _, err = inlineCSS(deep(maxInlineDepth + 1))
+	require.ErrorContains(t, err, "niveles de anidamiento")
+
+	// Los selectores demasiado largos no se incrustan
+	_, ok := compileSelector(strings.TrimSpace(strings.Repeat("div ", maxSelectorParts+1)))
+	require.False(t, ok)
+	_, ok = compileSelector(strings.TrimSpace(strings.Repeat("div ", maxSelectorParts)))
+	require.True(t, ok)
+}
+
+func TestPrepareEmailHTMLLogsEachRuleOnce(t *testing.T) {
+	count := func() int {
+		n := 0
+		loggedCSSWarnings.Range(func(any, any) bool { n++; return true })
+		return n
+	}
+	before := count()
+	// Selectores y valores distintos en cada pedido no agregan entradas
+	for i := range 50 {
+		prepareEmailHTML(fmt.Sprintf(`<html><head><style>.c%d { display: flex; } .c%d:hover { color: red; }</style></head><body><div class="c%d">Hola</div></body></html>`, i, i, i))
+	}
+	require.LessOrEqual(t, count()-before, 2)
+}
+
+func TestInlineCSSWithoutStyles(t *testing.T) {
+	document := "<p>Hola</p>"
+	out, warnings, err := inlineCSS(document)
+	require.NoError(t, err)
+	require.Equal(t, document, out)
+	require.Empty(t, warnings)
+}
+
+func TestInlineRecommendationTemplate(t *testing.T) {
+	data, err := recommendationData(RecommendationRequest{
+		Products: []Product{{Name: "Auriculares", BuyURL: "https://tienda.com/a", Price: 100}},
+	}, nil)
+	require.NoError(t, err)
+	document, err := generateRecommendationHTML(data)
+	require.NoError(t, err)
+
+	out := prepareEmailHTML(document)
+	require.Contains(t, out, `class="buy-btn" style="display: inline-block;`)
+	require.Contains(t, out, `class="recommendation-card" style="border: 2px solid #000;`)
+	require.Contains(t, out, ".buy-btn:hover")
+	require.NotContains(t, out, ".recommendation-card {")
+
+	t.Setenv("INLINE_CSS", "false")
+	require.Equal(t, document, prepareEmailHTML(document))
+}
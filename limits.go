@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Cuerpo aceptado por una ruta: tipos de contenido y tamaño máximo
+type bodyPolicy struct {
+	mediaTypes []string
+	maxSize    func() int64
+}
+
+var (
+	// Rutas sin cuerpo (GET, DELETE)
+	noBody = bodyPolicy{}
+	// JSON sin adjuntos, hasta MAX_BODY_SIZE (1MB)
+	jsonBody = bodyPolicy{[]string{"application/json"}, jsonBodyLimit}
+	// JSON con adjuntos en base64
+	attachmentBody = bodyPolicy{[]string{"application/json"}, attachmentBodyLimit}
+	// /send-email también acepta los adjuntos como multipart/form-data
+	emailBody = bodyPolicy{[]string{"application/json", "multipart/form-data"}, attachmentBodyLimit}
+	// El formulario de contacto puede venir directo de un <form>
+	formBody = bodyPolicy{[]string{"application/json", "application/x-www-form-urlencoded", "multipart/form-data"}, jsonBodyLimit}
+	// Importación de contactos, hasta MAX_IMPORT_BODY_SIZE (10MB)
+	csvBody = bodyPolicy{[]string{"text/csv", "multipart/form-data"}, importBodyLimit}
+)
+
+func jsonBodyLimit() int64 {
+	return envInt64("MAX_BODY_SIZE", 1<<20)
+}
+
+// Los adjuntos ocupan 4/3 en base64, más el resto de la petición. Se puede
+// fijar con MAX_ATTACHMENT_BODY_SIZE.
+func attachmentBodyLimit() int64 {
+	derived := loadAttachmentLimits().MaxTotalSize/3*4 + jsonBodyLimit()
+	return envInt64("MAX_ATTACHMENT_BODY_SIZE", derived)
+}
+
+func importBodyLimit() int64 {
+	return envInt64("MAX_IMPORT_BODY_SIZE", 10<<20)
+}
+
+// Rechaza los tipos de contenido que la ruta no acepta (415) y limita el
+// cuerpo con http.MaxBytesReader. Sin Content-Type se asume el primer tipo,
+// como hacían los handlers.
+func limitBody(policy bodyPolicy, next http.Handler) http.Handler {
+	if policy.maxSize == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			mediaType, _, err := mime.ParseMediaType(contentType)
+			if err != nil || !slices.Contains(policy.mediaTypes, mediaType) {
+				http.Error(w, fmt.Sprintf("Content-Type no soportado %q; se acepta %s", contentType, strings.Join(policy.mediaTypes, ", ")), http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+
+		limit := policy.maxSize()
+		if r.ContentLength > limit {
+			http.Error(w, fmt.Sprintf("El cuerpo supera el máximo de %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 413 si el cuerpo superó el límite de la ruta, 400 para el resto
+func bodyErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// Largos máximos de los textos de las peticiones, en caracteres
+const (
+	maxShortText = 256     // nombres, asuntos y teléfonos
+	maxLongText  = 5000    // descripciones y mensajes
+	maxBodyText  = 100_000 // cuerpo de /send-email
+	maxURLLength = 2048
+)
+
+// Cantidad máxima de productos por correo (MAX_PRODUCTS, 20 por defecto)
+func maxProducts() int {
+	return int(envInt64("MAX_PRODUCTS", 20))
+}
+
+// Campo de texto con su largo máximo
+type textLimit struct {
+	field string
+	value string
+	max   int
+}
+
+func checkTextLimits(limits ...textLimit) error {
+	for _, limit := range limits {
+		if utf8.RuneCountInString(limit.value) > limit.max {
+			return fmt.Errorf("%s supera el máximo de %d caracteres", limit.field, limit.max)
+		}
+	}
+	return nil
+}
+
+// Textos de la recomendación además de los productos
+func (req RecommendationRequest) checkTextLimits() error {
+	return checkTextLimits(
+		textLimit{"user_name", req.UserName, maxShortText},
+		textLimit{"subject", req.Subject, maxShortText},
+		textLimit{"call_to_action_url", req.CallToActionURL, maxURLLength},
+		textLimit{"phone_number", req.PhoneNumber, maxShortText},
+	)
+}
+
+func (req BatchRecommendationRequest) checkTextLimits() error {
+	return checkTextLimits(
+		textLimit{"subject", req.Subject, maxShortText},
+		textLimit{"call_to_action_url", req.CallToActionURL, maxURLLength},
+		textLimit{"phone_number", req.PhoneNumber, maxShortText},
+	)
+}
+
+// El HTML y el texto de /v2/send ya los limita el tamaño del cuerpo
+func (req SendRequest) checkTextLimits() error {
+	return checkTextLimits(textLimit{"subject", req.Subject, maxShortText})
+}
+
+func (req EmailRequest) checkTextLimits() error {
+	return checkTextLimits(
+		textLimit{"mail", req.Mail, maxShortText},
+		textLimit{"subject", req.Subject, maxShortText},
+		textLimit{"body", req.Body, maxBodyText},
+	)
+}
+
+func (req ContactFormRequest) checkTextLimits() error {
+	return checkTextLimits(
+		textLimit{"name", req.Name, maxShortText},
+		textLimit{"email", req.Email, maxShortText},
+		textLimit{"subject", req.Subject, maxShortText},
+		textLimit{"message", req.Message, maxLongText},
+	)
+}
+
+func (req CalendarInviteRequest) checkTextLimits() error {
+	return checkTextLimits(
+		textLimit{"summary", req.Summary, maxShortText},
+		textLimit{"description", req.Description, maxLongText},
+		textLimit{"location", req.Location, maxShortText},
+		textLimit{"phone_number", req.PhoneNumber, maxShortText},
+	)
+}
+
+// Los contactos llegan por la API y por CSV, así que se revisan al normalizar
+func (c Contact) checkTextLimits() error {
+	limits := []textLimit{
+		{"email", c.Email, maxShortText},
+		{"name", c.Name, maxShortText},
+		{"locale", c.Locale, maxShortText},
+		{"timezone", c.TimeZone, maxShortText},
+		{"phone", c.Phone, maxShortText},
+	}
+	for _, tag := range c.Tags {
+		limits = append(limits, textLimit{"tags", tag, maxShortText})
+	}
+	for key, value := range c.Attributes {
+		limits = append(limits,
+			textLimit{"attributes", key, maxShortText},
+			textLimit{"attributes." + key, value, maxLongText})
+	}
+	return checkTextLimits(limits...)
+}
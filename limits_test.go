@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitBody(t *testing.T) {
+	t.Setenv("MAX_BODY_SIZE", "64")
+	router := newRouter()
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	body := `{"phone_number": "` + strings.Repeat("9", 100) + `"}`
+
+	// Content-Length declarado mayor que el límite
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/call-action", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	require.Equal(t, http.StatusRequestEntityTooLarge, serve(req).Code)
+
+	// Sin Content-Length el límite se aplica al leer
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/call-action", io.MultiReader(strings.NewReader(body)))
+	require.Equal(t, int64(-1), req.ContentLength)
+	require.Equal(t, http.StatusRequestEntityTooLarge, serve(req).Code)
+
+	// Los alias obsoletos tienen el mismo límite
+	req = httptest.NewRequest(http.MethodPost, "/call-action", strings.NewReader(body))
+	require.Equal(t, http.StatusRequestEntityTooLarge, serve(req).Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/themes/acme", strings.NewReader("name=acme"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := serve(req)
+	require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	require.Contains(t, rec.Body.String(), "application/json")
+
+	// El formulario de contacto sí acepta formularios HTML
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/contact", strings.NewReader("email=ana@ejemplo.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	require.Equal(t, http.StatusBadRequest, serve(req).Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/contacts/import", strings.NewReader("email\nana@ejemplo.com\n"))
+	req.Header.Set("Content-Type", "application/json")
+	require.Equal(t, http.StatusUnsupportedMediaType, serve(req).Code)
+}
+
+func TestRecommendationTextLimits(t *testing.T) {
+	require.NoError(t, sampleRecommendationRequest().checkTextLimits())
+
+	req := RecommendationRequest{UserName: strings.Repeat("ñ", maxShortText)}
+	require.NoError(t, req.checkTextLimits())
+	req.UserName += "ñ"
+	require.ErrorContains(t, req.checkTextLimits(), "user_name")
+
+	batch := BatchRecommendationRequest{Subject: "Ofertas", CallToActionURL: "https://" + strings.Repeat("a", maxURLLength)}
+	require.ErrorContains(t, batch.checkTextLimits(), "call_to_action_url")
+}
+
+func TestRequestTextLimits(t *testing.T) {
+	long := strings.Repeat("a", maxShortText+1)
+
+	require.NoError(t, SendRequest{Subject: "Hola"}.checkTextLimits())
+	require.ErrorContains(t, SendRequest{Subject: long}.checkTextLimits(), "subject")
+	require.NoError(t, EmailRequest{Body: strings.Repeat("a", maxLongText+1)}.checkTextLimits())
+	require.ErrorContains(t, EmailRequest{Mail: long}.checkTextLimits(), "mail")
+	require.ErrorContains(t, EmailRequest{Body: strings.Repeat("a", maxBodyText+1)}.checkTextLimits(), "body")
+	require.ErrorContains(t, ContactFormRequest{Message: strings.Repeat("a", maxLongText+1)}.checkTextLimits(), "message")
+	require.ErrorContains(t, CalendarInviteRequest{Location: long}.checkTextLimits(), "location")
+	require.ErrorContains(t, CalendarInviteRequest{Description: strings.Repeat("a", maxLongText+1)}.checkTextLimits(), "description")
+
+	// Los contactos se revisan al crearlos o importarlos
+	store, err := newContactStore(filepath.Join(t.TempDir(), "contacts.json"))
+	require.NoError(t, err)
+	_, err = store.Create(Contact{Email: "ana@ejemplo.com", Name: long})
+	require.ErrorIs(t, err, errInvalidContact)
+	require.ErrorContains(t, err, "name")
+	_, _, err = store.Import([]Contact{{Email: "ana@ejemplo.com", Tags: []string{long}}})
+	require.ErrorIs(t, err, errInvalidContact)
+
+	// Los handlers responden 400
+	t.Setenv("EMAIL_SENDER_ADDRESS", "")
+	rec := httptest.NewRecorder()
+	sendHandler(rec, httptest.NewRequest(http.MethodPost, "/v2/send", strings.NewReader(
+		`{"to": ["juan@ejemplo.com"], "subject": "`+long+`", "text": "Hola"}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "subject supera el máximo")
+
+	req := httptest.NewRequest(http.MethodPost, "/contact", strings.NewReader(`{"email": "juan@ejemplo.com", "name": "`+long+`", "message": "Hola"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	contactFormHandler(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCallActionSecurityHeaders(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer api.Close()
+	saved := phoneCallAPIURL
+	phoneCallAPIURL = api.URL
+	t.Cleanup(func() { phoneCallAPIURL = saved })
+
+	rec := httptest.NewRecorder()
+	callActionHandler(rec, httptest.NewRequest(http.MethodGet, "/call-action?phone=%3Cscript%3Ealert(1)%3C/script%3E", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Security-Policy"), "default-src 'none'")
+	require.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	require.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	require.NotContains(t, rec.Body.String(), "<script>")
+	require.Contains(t, rec.Body.String(), "&lt;script&gt;")
+}
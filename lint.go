@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Gmail corta el mensaje y muestra "[Mensaje recortado]" sobre este tamaño
+const gmailClipBytes = 102 * 1024
+
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// Problema encontrado en el HTML de un correo
+type LintIssue struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+	Clients  []string     `json:"clients,omitempty"`
+}
+
+// Resultado de revisar un correo renderizado
+type LintReport struct {
+	Template  string      `json:"template"`
+	Size      int         `json:"size"`
+	SizeLimit int         `json:"size_limit"`
+	HasText   bool        `json:"has_text"`
+	Issues    []LintIssue `json:"issues"`
+	// Cantidad de problemas por familia de clientes
+	Clients map[string]int `json:"clients"`
+}
+
+func (r LintReport) HasErrors() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == LintError {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *LintReport) add(rule string, severity LintSeverity, clients []string, format string, args ...any) {
+	r.Issues = append(r.Issues, LintIssue{Rule: rule, Severity: severity, Message: fmt.Sprintf(format, args...), Clients: clients})
+	for _, client := range clients {
+		r.Clients[client]++
+	}
+}
+
+// Revisar el HTML final (ya con el CSS incrustado) y la parte de texto
+func lintEmail(name string, document string, text string) LintReport {
+	report := LintReport{
+		Template:  name,
+		Size:      len(document),
+		SizeLimit: gmailClipBytes,
+		HasText:   strings.TrimSpace(text) != "",
+		Issues:    []LintIssue{},
+		Clients:   map[string]int{},
+	}
+
+	switch {
+	case report.Size > gmailClipBytes:
+		report.add("size", LintError, []string{"gmail"}, "el HTML pesa %d bytes y Gmail lo recorta sobre %d", report.Size, gmailClipBytes)
+	case report.Size > gmailClipBytes*9/10:
+		report.add("size", LintWarning, []string{"gmail"}, "el HTML pesa %d bytes, cerca del límite de %d de Gmail", report.Size, gmailClipBytes)
+	}
+	if !report.HasText {
+		report.add("missing-text", LintWarning, nil, "falta la parte de texto plano; algunos clientes y filtros de spam la esperan")
+	}
+
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		report.add("parse", LintError, nil, "HTML inválido: %v", err)
+		return report
+	}
+
+	// Cada propiedad se informa una vez aunque aparezca en muchos elementos
+	seen := map[string]bool{}
+	checkCSS := func(where string, declarations []cssDeclaration) {
+		for _, d := range declarations {
+			clients := unsupportedClients(d)
+			key := d.Property + ":" + d.Value
+			if clients == nil || seen[key] {
+				continue
+			}
+			seen[key] = true
+			report.add("unsupported-css", LintWarning, clients, "%s: %s: %s no funciona en %s", where, d.Property, d.Value, strings.Join(clients, ", "))
+		}
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Style:
+				var css strings.Builder
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					css.WriteString(c.Data)
+				}
+				lintStyleSheet(&report, parseStyleSheet(css.String()), checkCSS)
+			case atom.Link:
+				if rel, _ := attr(n, "rel"); strings.EqualFold(rel, "stylesheet") {
+					href, _ := attr(n, "href")
+					report.add("external-css", LintError, []string{"gmail", "outlook", "yahoo"}, "hoja de estilos externa %s", href)
+				}
+			case atom.Img:
+				lintImage(&report, n)
+			case atom.A:
+				lintLink(&report, n)
+			}
+			if style, ok := attr(n, "style"); ok {
+				where := "<" + n.Data + ">"
+				if class, ok := attr(n, "class"); ok {
+					where = fmt.Sprintf("<%s class=%q>", n.Data, class)
+				}
+				checkCSS(where, parseDeclarations(style))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return report
+}
+
+func lintStyleSheet(report *LintReport, sheet styleSheet, checkCSS func(string, []cssDeclaration)) {
+	for _, rule := range sheet.Rules {
+		checkCSS(rule.Selector, rule.Declarations)
+		if strings.Contains(rule.Selector, ":") {
+			report.add("pseudo-class", LintWarning, []string{"outlook", "yahoo"}, "%s: las pseudo-clases solo funcionan en algunos clientes", rule.Selector)
+		}
+	}
+	// @media se deja pasar: Outlook de escritorio lo ignora sin romper nada
+	for _, at := range sheet.AtRules {
+		lower := strings.ToLower(at)
+		if strings.HasPrefix(lower, "@import") || strings.HasPrefix(lower, "@font-face") {
+			report.add("external-font", LintWarning, []string{"gmail", "outlook", "yahoo"}, "fuente externa ignorada por la mayoría de los clientes: %.60s", at)
+		}
+	}
+}
+
+func lintImage(report *LintReport, n *html.Node) {
+	src, _ := attr(n, "src")
+	alt, hasAlt := attr(n, "alt")
+	switch {
+	case !hasAlt:
+		report.add("missing-alt", LintError, nil, "imagen %s sin atributo alt", src)
+	case strings.TrimSpace(alt) == "":
+		report.add("missing-alt", LintWarning, nil, "imagen %s con alt vacío", src)
+	}
+	lower := strings.ToLower(src)
+	if !strings.HasPrefix(lower, "cid:") && !strings.HasPrefix(lower, "data:image/") {
+		lintURL(report, "imagen", src)
+	}
+}
+
+func lintLink(report *LintReport, n *html.Node) {
+	href, ok := attr(n, "href")
+	if !ok {
+		return
+	}
+	lower := strings.ToLower(href)
+	if strings.HasPrefix(lower, "mailto:") || strings.HasPrefix(lower, "tel:") {
+		return
+	}
+	lintURL(report, "enlace", href)
+}
+
+// Los enlaces del correo deben ser absolutos; no hay página base contra la
+// que resolver "/producto" ni "#"
+func lintURL(report *LintReport, kind string, raw string) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	switch {
+	case raw == "" || raw == "#":
+		report.add("broken-link", LintError, nil, "%s vacío o \"#\"", kind)
+	case err != nil:
+		report.add("broken-link", LintError, nil, "%s inválido %q: %v", kind, raw, err)
+	case u.Scheme == "":
+		report.add("relative-link", LintError, nil, "%s relativo %q", kind, raw)
+	case u.Scheme != "http" && u.Scheme != "https":
+		report.add("broken-link", LintError, nil, "%s con esquema no permitido %q", kind, raw)
+	case u.Host == "":
+		report.add("broken-link", LintError, nil, "%s sin dominio %q", kind, raw)
+	case u.Scheme == "http":
+		report.add("insecure-link", LintWarning, nil, "%s sin https %q", kind, raw)
+	}
+}
+
+// Reglas ya registradas por plantilla, para no repetirlas en cada envío. El
+// mensaje trae URLs y src del pedido, así que no forma parte de la clave: el
+// mapa queda acotado por plantillas × reglas.
+var loggedLintIssues sync.Map
+
+// Revisar cada correo renderizado antes de enviarlo y dejar los problemas en
+// el log. No bloquea el envío.
+func lintRendered(name string, document string, text string) LintReport {
+	report := lintEmail(name, document, text)
+	for _, issue := range report.Issues {
+		// Los avisos de CSS ya los registró prepareEmailHTML
+		if issue.Rule == "unsupported-css" || issue.Rule == "pseudo-class" {
+			continue
+		}
+		key := name + "|" + issue.Rule
+		if _, logged := loggedLintIssues.LoadOrStore(key, true); logged {
+			continue
+		}
+		level := slog.LevelWarn
+		if issue.Severity == LintError {
+			level = slog.LevelError
+		}
+		slog.Log(context.Background(), level, "problema en la plantilla",
+			"template", name, "rule", issue.Rule, "issue", issue.Message)
+	}
+	return report
+}
+
+var errTemplateNotFound = errors.New("plantilla no encontrada")
+
+// Pedido de ejemplo para revisar la plantilla sin datos reales
+func sampleRecommendationRequest() RecommendationRequest {
+	return RecommendationRequest{
+		UserName: "Juan Pérez",
+		Subject:  "Productos seleccionados para ti",
+		Products: []Product{
+			{
+				Name: "Auriculares Premium Bluetooth", Description: "Calidad de sonido excepcional.",
+				Image: "https://ejemplo.com/auriculares.jpg", BuyURL: "https://tienda.com/auriculares",
+				Price: 39990, OriginalPrice: 49990, Currency: "CLP", Rating: 4.5, Stock: StockLow,
+				Badges: []string{"Nuevo"}, SKU: "AUR-001",
+			},
+			{Name: "Cargador Inalámbrico", Description: "Carga rápida.", BuyURL: "https://tienda.com/cargador"},
+		},
+		CallToActionURL: "https://tienda.com",
+		PhoneNumber:     "+56912345678",
+	}
+}
+
+// Renderizar una plantilla incluida tal como se envía, con el CSS incrustado
+func renderTemplateForLint(name string, req RecommendationRequest) (string, error) {
+	switch strings.TrimSuffix(name, ".html") {
+	case "recommendation":
+	default:
+		return "", fmt.Errorf("%w: %q", errTemplateNotFound, name)
+	}
+	products, err := normalizeProducts(req.Products)
+	if err != nil {
+		return "", err
+	}
+	req.Products = products
+	data, err := recommendationData(req, nil)
+	if err != nil {
+		return "", err
+	}
+	document, err := generateRecommendationHTML(data)
+	if err != nil {
+		return "", err
+	}
+	inlined, _, err := inlineCSS(document)
+	return inlined, err
+}
+
+// Handler de /templates/{name}/lint: GET usa datos de ejemplo y POST los de
+// un pedido de recomendaciones
+func templateLintHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	req := sampleRecommendationRequest()
+	if r.Method == http.MethodPost {
+		req = RecommendationRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
+			return
+		}
+	} else {
+		req.Locale = r.URL.Query().Get("locale")
+		req.Brand = r.URL.Query().Get("brand")
+	}
+
+	document, err := renderTemplateForLint(name, req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errTemplateNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, http.StatusOK, lintEmail(name, document, ""))
+}
+
+// Subcomando "lint": revisa plantillas incluidas o archivos .html y termina
+// con código 1 si hay errores
+//
+//	email-api lint [-locale es] [-brand acme] [recommendation] [correo.html ...]
+func runLintCommand(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(out)
+	locale := flags.String("locale", "", "idioma de los datos de ejemplo")
+	brand := flags.String("brand", "", "tema de marca")
+	textFile := flags.String("text", "", "archivo con la parte de texto plano")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	targets := flags.Args()
+	if len(targets) == 0 {
+		targets = []string{"recommendation"}
+	}
+	text := ""
+	if *textFile != "" {
+		data, err := os.ReadFile(*textFile)
+		if err != nil {
+			fmt.Fprintf(out, "❌ %v\n", err)
+			return 2
+		}
+		text = string(data)
+	}
+
+	failed := false
+	for _, target := range targets {
+		var document string
+		var err error
+		if strings.HasSuffix(target, ".html") && fileExists(target) {
+			var data []byte
+			data, err = os.ReadFile(target)
+			document = string(data)
+		} else {
+			req := sampleRecommendationRequest()
+			req.Locale, req.Brand = *locale, *brand
+			document, err = renderTemplateForLint(target, req)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "❌ %s: %v\n", target, err)
+			failed = true
+			continue
+		}
+		report := lintEmail(target, document, text)
+		printLintReport(out, report)
+		failed = failed || report.HasErrors()
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func printLintReport(out io.Writer, report LintReport) {
+	fmt.Fprintf(out, "%s: %d bytes (límite de Gmail %d), %d problemas\n", report.Template, report.Size, report.SizeLimit, len(report.Issues))
+	for _, issue := range report.Issues {
+		fmt.Fprintf(out, "  %-7s %-16s %s\n", issue.Severity, issue.Rule, issue.Message)
+	}
+	clients := make([]string, 0, len(report.Clients))
+	for client := range report.Clients {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	for _, client := range clients {
+		fmt.Fprintf(out, "  %s: %d problemas\n", client, report.Clients[client])
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func lintRules(report LintReport) map[string]LintSeverity {
+	rules := map[string]LintSeverity{}
+	for _, issue := range report.Issues {
+		if rules[issue.Rule] != LintError {
+			rules[issue.Rule] = issue.Severity
+		}
+	}
+	return rules
+}
+
+func TestLintEmail(t *testing.T) {
+	document := `<html><head><style>
+		@import url(https://fonts.googleapis.com/css?family=Roboto);
+		.grid { display: grid; }
+	</style></head><body>
+		<img src="https://tienda.com/a.jpg">
+		<img src="cid:product-0" alt="">
+		<a href="/producto">Ver</a>
+		<a href="#">Comprar</a>
+		<a href="javascript:alert(1)">Clic</a>
+		<a href="mailto:hola@tienda.com">Escríbenos</a>
+		<div style="display: flex">x</div>
+	</body></html>`
+
+	report := lintEmail("prueba", document, "")
+	require.True(t, report.HasErrors())
+	require.False(t, report.HasText)
+	require.Equal(t, map[string]LintSeverity{
+		"missing-text":    LintWarning,
+		"external-font":   LintWarning,
+		"unsupported-css": LintWarning,
+		"missing-alt":     LintError,
+		"relative-link":   LintError,
+		"broken-link":     LintError,
+	}, lintRules(report))
+	require.Equal(t, 3, report.Clients["outlook"])
+	require.Equal(t, 2, report.Clients["gmail"])
+}
+
+func TestLintEmailSize(t *testing.T) {
+	document := "<p>" + strings.Repeat("a", gmailClipBytes) + "</p>"
+	report := lintEmail("grande", document, "texto")
+	require.True(t, report.HasErrors())
+	require.Equal(t, LintError, lintRules(report)["size"])
+
+	report = lintEmail("normal", `<p><a href="https://tienda.com">Tienda</a></p>`, "texto")
+	require.Empty(t, report.Issues)
+}
+
+func TestTemplateLintHandler(t *testing.T) {
+	router := newRouter()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/templates/recommendation/lint?locale=es", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var report LintReport
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	require.Equal(t, "recommendation", report.Template)
+	require.False(t, report.HasErrors())
+	require.Equal(t, LintWarning, lintRules(report)["missing-text"])
+
+	// Con los datos del pedido: un producto sin enlace de compra
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/templates/recommendation.html/lint",
+		strings.NewReader(`{"products":[{"name":"Cable","image":"https://tienda.com/cable.jpg"}]}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	report = LintReport{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	require.Equal(t, LintError, lintRules(report)["broken-link"])
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/templates/otra/lint", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRunLintCommand(t *testing.T) {
+	var out bytes.Buffer
+	require.Equal(t, 0, runLintCommand([]string{"-locale", "es", "recommendation"}, &out))
+	require.Contains(t, out.String(), "recommendation:")
+
+	path := filepath.Join(t.TempDir(), "correo.html")
+	require.NoError(t, os.WriteFile(path, []byte(`<img src="logo.png">`), 0o644))
+	out.Reset()
+	require.Equal(t, 1, runLintCommand([]string{path}, &out))
+	require.Contains(t, out.String(), "missing-alt")
+	require.Contains(t, out.String(), "relative-link")
+}
+
+func TestLintRenderedLogsEachRuleOnce(t *testing.T) {
+	count := func() int {
+		n := 0
+		loggedLintIssues.Range(func(any, any) bool { n++; return true })
+		return n
+	}
+	before := count()
+	for i := range 50 {
+		lintRendered("prueba-lint", fmt.Sprintf(`<html><body><img src="https://cdn.tienda.com/%d.png"><a href="http://tienda.com/%d">Ver</a></body></html>`, i, i), "")
+	}
+	require.LessOrEqual(t, count()-before, 3)
+}
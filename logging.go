@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"email-api/mail"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Qué datos personales se ocultan en los logs, según LOG_REDACT
+type redactor struct {
+	emails   bool
+	phones   bool
+	subjects bool
+}
+
+// LOG_REDACT es una lista como "email,phone,subject" (por defecto todos) o "none"
+func loadRedactor() redactor {
+	value := strings.ToLower(os.Getenv("LOG_REDACT"))
+	if value == "" {
+		return redactor{emails: true, phones: true, subjects: true}
+	}
+	var r redactor
+	for _, field := range strings.Split(value, ",") {
+		switch strings.TrimSpace(field) {
+		case "email", "emails":
+			r.emails = true
+		case "phone", "phones":
+			r.phones = true
+		case "subject", "subjects":
+			r.subjects = true
+		}
+	}
+	return r
+}
+
+var (
+	logEmailPattern = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`)
+	logPhonePattern = regexp.MustCompile(`\+\d[\d\s().\-]{6,}\d`)
+)
+
+const redactedValue = "[REDACTED]"
+
+// juan.perez@gmail.com -> j***@gmail.com
+func maskEmail(address string) string {
+	local, domain, ok := strings.Cut(address, "@")
+	if !ok || local == "" {
+		return redactedValue
+	}
+	return local[:1] + "***@" + domain
+}
+
+// +56973756474 -> ***6474
+func maskPhone(phone string) string {
+	digits := make([]rune, 0, len(phone))
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) <= 4 {
+		return "***"
+	}
+	return "***" + string(digits[len(digits)-4:])
+}
+
+func (r redactor) redactString(key string, s string) string {
+	switch key {
+	case "subject":
+		if r.subjects && s != "" {
+			return redactedValue
+		}
+	case "phone", "phone_number":
+		if r.phones && s != "" {
+			return maskPhone(s)
+		}
+	}
+	if r.emails {
+		s = logEmailPattern.ReplaceAllStringFunc(s, maskEmail)
+	}
+	if r.phones {
+		s = logPhonePattern.ReplaceAllStringFunc(s, maskPhone)
+	}
+	return s
+}
+
+// ReplaceAttr del handler: revisa el mensaje y todos los atributos de texto,
+// incluidos los errores, que suelen traer la dirección que el SMTP rechazó
+func (r redactor) replaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if !r.emails && !r.phones && !r.subjects {
+		return a
+	}
+	value := a.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(r.redactString(a.Key, value.String()))
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(r.redactString(a.Key, v.Error()))
+		case []string:
+			redacted := make([]string, len(v))
+			for i, s := range v {
+				redacted[i] = r.redactString(a.Key, s)
+			}
+			a.Value = slog.AnyValue(redacted)
+		}
+	}
+	return a
+}
+
+// Agrega el request_id y el trace_id del contexto a cada registro, también a
+// los del paquete mail y de la cola
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := mail.RequestIDFrom(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+func parseLogLevel(value string) slog.Level {
+	switch strings.ToLower(value) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// Logger JSON con nivel LOG_LEVEL (debug, info, warn, error) y los datos
+// personales ocultos según LOG_REDACT. LOG_FORMAT=text para desarrollo.
+func newLogger(out io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       parseLogLevel(os.Getenv("LOG_LEVEL")),
+		ReplaceAttr: loadRedactor().replaceAttr,
+	}
+	var handler slog.Handler = slog.NewJSONHandler(out, options)
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		handler = slog.NewTextHandler(out, options)
+	}
+	return slog.New(requestIDHandler{handler})
+}
+
+func setupLogging() {
+	slog.SetDefault(newLogger(os.Stdout))
+}
+
+// Reemplazo de log.Fatalf para errores de arranque
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+var requestIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._\-]{1,64}$`)
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Código de respuesta para el log de cada petición
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Asigna un ID a cada petición (o usa el X-Request-ID recibido), lo devuelve
+// en la respuesta y lo deja en el contexto para los logs y el envío del correo
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := mail.WithRequestID(r.Context(), id)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "petición atendida",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds())
+	})
+}
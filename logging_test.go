@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"email-api/mail"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decodeLogLines(t *testing.T, out *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLoggerRedaction(t *testing.T) {
+	var out bytes.Buffer
+	logger := newLogger(&out)
+	logger.Info("enviando a juan.perez@gmail.com",
+		"subject", "Tu pedido 123",
+		"phone", "+56 9 7375 6474",
+		"recipients", []string{"ana@ejemplo.com"},
+		"error", errors.New("550 buzón inexistente: ana@ejemplo.com, llamar al +56973756474"))
+
+	record := decodeLogLines(t, &out)[0]
+	require.Equal(t, "enviando a j***@gmail.com", record["msg"])
+	require.Equal(t, "[REDACTED]", record["subject"])
+	require.Equal(t, "***6474", record["phone"])
+	require.Equal(t, []any{"a***@ejemplo.com"}, record["recipients"])
+	require.Equal(t, "550 buzón inexistente: a***@ejemplo.com, llamar al ***6474", record["error"])
+	require.NotContains(t, out.String(), "juan.perez")
+
+	t.Setenv("LOG_REDACT", "phone")
+	out.Reset()
+	newLogger(&out).Info("contacto", "email", "ana@ejemplo.com", "subject", "Hola", "phone", "+56973756474")
+	record = decodeLogLines(t, &out)[0]
+	require.Equal(t, "ana@ejemplo.com", record["email"])
+	require.Equal(t, "Hola", record["subject"])
+	require.Equal(t, "***6474", record["phone"])
+}
+
+func TestLoggerLevel(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "warn")
+	var out bytes.Buffer
+	logger := newLogger(&out)
+	logger.Info("no aparece")
+	logger.Warn("aparece")
+	records := decodeLogLines(t, &out)
+	require.Len(t, records, 1)
+	require.Equal(t, "WARN", records[0]["level"])
+}
+
+func TestWithRequestID(t *testing.T) {
+	var out bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(newLogger(&out))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	var seen string
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = mail.RequestIDFrom(r.Context())
+		slog.InfoContext(r.Context(), "dentro del handler")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v2/send", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, "abc-123", seen)
+	require.Equal(t, "abc-123", rec.Header().Get("X-Request-ID"))
+
+	records := decodeLogLines(t, &out)
+	require.Len(t, records, 2)
+	for _, record := range records {
+		require.Equal(t, "abc-123", record["request_id"])
+	}
+	require.Equal(t, float64(http.StatusAccepted), records[1]["status"])
+
+	// Un ID inválido se reemplaza por uno nuevo
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Request-ID", "no válido\n")
+	handler.ServeHTTP(rec, req)
+	require.Len(t, seen, 16)
+	require.Equal(t, seen, rec.Header().Get("X-Request-ID"))
+}
+
+func TestSendQueueKeepsRequestID(t *testing.T) {
+	ids := make(chan string, 1)
+	send := func(ctx context.Context, msg mail.Message) error {
+		ids <- mail.RequestIDFrom(ctx)
+		return nil
+	}
+	q, err := newSendQueue(t.TempDir(), send, 1, time.Millisecond)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx, 1)
+
+	_, err = q.Enqueue(mail.WithRequestID(context.Background(), "lote-42"), "lote", testQueueMessage(t, "a@ejemplo.com"))
+	require.NoError(t, err)
+	select {
+	case id := <-ids:
+		require.Equal(t, "lote-42", id)
+	case <-time.After(time.Second):
+		t.Fatal("el mensaje no se envió")
+	}
+}
@@ -0,0 +1,17 @@
+package mail
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID guarda en ctx el ID de la petición que originó el envío, para
+// relacionar los logs del envío con ella
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom devuelve el ID guardado con WithRequestID o "" si no hay
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
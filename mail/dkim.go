@@ -0,0 +1,113 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// Cabeceras firmadas, según la recomendación de RFC 6376 sección 5.4.1
+var dkimHeaderKeys = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc",
+	"Message-Id", "MIME-Version", "Content-Type",
+}
+
+// DKIMKey es la clave privada y el selector usados para firmar un dominio
+type DKIMKey struct {
+	Domain   string
+	Selector string
+	Signer   crypto.Signer
+}
+
+// DKIMSigner firma los mensajes salientes eligiendo la clave por dominio del remitente
+type DKIMSigner struct {
+	keys map[string]DKIMKey
+}
+
+func NewDKIMSigner(keys ...DKIMKey) *DKIMSigner {
+	signer := &DKIMSigner{keys: make(map[string]DKIMKey, len(keys))}
+	for _, key := range keys {
+		signer.keys[strings.ToLower(key.Domain)] = key
+	}
+	return signer
+}
+
+// LoadDKIMKey lee una clave privada PEM (RSA o Ed25519) desde disco
+func LoadDKIMKey(domain string, selector string, path string) (DKIMKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DKIMKey{}, fmt.Errorf("error reading DKIM key for %s: %w", domain, err)
+	}
+
+	signer, err := ParseDKIMPrivateKey(data)
+	if err != nil {
+		return DKIMKey{}, fmt.Errorf("error parsing DKIM key for %s: %w", domain, err)
+	}
+
+	return DKIMKey{Domain: domain, Selector: selector, Signer: signer}, nil
+}
+
+// ParseDKIMPrivateKey acepta claves RSA en PKCS#1 o PKCS#8 y claves Ed25519 en PKCS#8
+func ParseDKIMPrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported DKIM key type %T", key)
+	}
+}
+
+// Sign agrega la cabecera DKIM-Signature al mensaje MIME ya construido.
+// Si no hay clave para el dominio del remitente el mensaje se devuelve sin cambios.
+func (s *DKIMSigner) Sign(from string, msg []byte) ([]byte, error) {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sender address: %w", err)
+	}
+
+	domain := strings.ToLower(addr.Address[strings.LastIndex(addr.Address, "@")+1:])
+	key, ok := s.keys[domain]
+	if !ok {
+		return msg, nil
+	}
+
+	var signed bytes.Buffer
+	options := &dkim.SignOptions{
+		Domain:                 key.Domain,
+		Selector:               key.Selector,
+		Signer:                 key.Signer,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+		HeaderKeys:             dkimHeaderKeys,
+	}
+	if err := dkim.Sign(&signed, bytes.NewReader(msg), options); err != nil {
+		return nil, fmt.Errorf("error signing message: %w", err)
+	}
+
+	return signed.Bytes(), nil
+}
@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/jordan-wright/email"
+	"github.com/stretchr/testify/require"
+)
+
+func buildTestMessage(t *testing.T, from string) []byte {
+	e := email.NewEmail()
+	e.From = from
+	e.To = []string{"cliente@ejemplo.com"}
+	e.Subject = "Productos especiales seleccionados para ti"
+	e.HTML = []byte("<h1>Hola</h1><p>Mensaje de prueba</p>")
+	e.Text = []byte("Hola\r\nMensaje de prueba")
+
+	raw, err := e.Bytes()
+	require.NoError(t, err)
+	return raw
+}
+
+func dkimTXTRecord(t *testing.T, pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		require.NoError(t, err)
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(k)
+	}
+	t.Fatalf("unsupported key %T", pub)
+	return ""
+}
+
+func TestDKIMSignVerifies(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for name, key := range map[string]crypto.Signer{"rsa": rsaKey, "ed25519": edKey} {
+		t.Run(name, func(t *testing.T) {
+			signer := NewDKIMSigner(DKIMKey{Domain: "tienda.com", Selector: "mail2024", Signer: key})
+
+			signed, err := signer.Sign("Tienda <ventas@Tienda.com>", buildTestMessage(t, "Tienda <ventas@tienda.com>"))
+			require.NoError(t, err)
+
+			verifications, err := dkim.VerifyWithOptions(bytes.NewReader(signed), &dkim.VerifyOptions{
+				LookupTXT: func(domain string) ([]string, error) {
+					require.Equal(t, "mail2024._domainkey.tienda.com", domain)
+					return []string{dkimTXTRecord(t, key.Public())}, nil
+				},
+			})
+			require.NoError(t, err)
+			require.Len(t, verifications, 1)
+			require.NoError(t, verifications[0].Err)
+			require.Equal(t, "tienda.com", verifications[0].Domain)
+		})
+	}
+}
+
+func TestDKIMSignDetectsTampering(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer := NewDKIMSigner(DKIMKey{Domain: "tienda.com", Selector: "s1", Signer: key})
+
+	signed, err := signer.Sign("ventas@tienda.com", buildTestMessage(t, "ventas@tienda.com"))
+	require.NoError(t, err)
+	tampered := bytes.Replace(signed, []byte("Mensaje de prueba"), []byte("Mensaje alterado!"), 1)
+
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(tampered), &dkim.VerifyOptions{
+		LookupTXT: func(string) ([]string, error) {
+			return []string{dkimTXTRecord(t, key.Public())}, nil
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, verifications, 1)
+	require.Error(t, verifications[0].Err)
+}
+
+func TestDKIMSignSkipsUnknownDomain(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer := NewDKIMSigner(DKIMKey{Domain: "tienda.com", Selector: "s1", Signer: key})
+
+	msg := buildTestMessage(t, "someone@gmail.com")
+	signed, err := signer.Sign("someone@gmail.com", msg)
+	require.NoError(t, err)
+	require.Equal(t, msg, signed)
+}
+
+func TestParseDKIMPrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	pkcs8RSA, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	pkcs8Ed, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+
+	blocks := []*pem.Block{
+		{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		{Type: "PRIVATE KEY", Bytes: pkcs8RSA},
+		{Type: "PRIVATE KEY", Bytes: pkcs8Ed},
+	}
+	for _, block := range blocks {
+		signer, err := ParseDKIMPrivateKey(pem.EncodeToMemory(block))
+		require.NoError(t, err)
+		require.NotNil(t, signer)
+	}
+
+	_, err = ParseDKIMPrivateKey([]byte("not a key"))
+	require.Error(t, err)
+}
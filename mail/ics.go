@@ -0,0 +1,256 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CalendarMethod es el METHOD de iTIP (RFC 5546) del objeto iCalendar
+type CalendarMethod string
+
+const (
+	CalendarRequest CalendarMethod = "REQUEST"
+	CalendarCancel  CalendarMethod = "CANCEL"
+)
+
+const icsProductID = "-//email-api//Calendar Invite//ES"
+
+// Event es una reunión enviada como invitación iCalendar (RFC 5545).
+// Una actualización es un REQUEST con el mismo UID y un Sequence mayor.
+type Event struct {
+	UID         string
+	Sequence    int
+	Method      CalendarMethod
+	Organizer   *mail.Address
+	Attendees   []*mail.Address
+	Start       time.Time
+	End         time.Time
+	TimeZone    *time.Location
+	Summary     string
+	Description string
+	Place       string
+	Phone       string
+	Stamp       time.Time
+}
+
+// ContentType es el tipo MIME que hace que Gmail y Outlook muestren los botones de respuesta
+func (ev Event) ContentType() string {
+	return fmt.Sprintf("text/calendar; charset=UTF-8; method=%s", ev.Method)
+}
+
+func (ev Event) validate() error {
+	switch {
+	case ev.UID == "":
+		return errors.New("event UID is required")
+	case ev.Organizer == nil:
+		return errors.New("event organizer is required")
+	case len(ev.Attendees) == 0:
+		return errors.New("at least one attendee is required")
+	case ev.Start.IsZero() || ev.End.IsZero():
+		return errors.New("event start and end are required")
+	case !ev.End.After(ev.Start):
+		return errors.New("event end must be after start")
+	case ev.Method != CalendarRequest && ev.Method != CalendarCancel:
+		return fmt.Errorf("unsupported calendar method %q", ev.Method)
+	}
+	return nil
+}
+
+// ICS genera el objeto VCALENDAR con CRLF y líneas plegadas a 75 octetos
+func (ev Event) ICS() ([]byte, error) {
+	if err := ev.validate(); err != nil {
+		return nil, err
+	}
+	loc := ev.TimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	stamp := ev.Stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+
+	var b icsWriter
+	b.line("BEGIN:VCALENDAR")
+	b.line("PRODID:" + icsProductID)
+	b.line("VERSION:2.0")
+	b.line("CALSCALE:GREGORIAN")
+	b.line("METHOD:" + string(ev.Method))
+	if loc != time.UTC {
+		writeTimezone(&b, loc, ev.Start)
+	}
+
+	b.line("BEGIN:VEVENT")
+	b.line("UID:" + escapeText(ev.UID))
+	b.line(fmt.Sprintf("SEQUENCE:%d", ev.Sequence))
+	b.line("DTSTAMP:" + stamp.UTC().Format("20060102T150405Z"))
+	b.line(formatDateTime("DTSTART", ev.Start, loc))
+	b.line(formatDateTime("DTEND", ev.End, loc))
+	b.line("SUMMARY:" + escapeText(ev.Summary))
+
+	description := ev.Description
+	if ev.Phone != "" {
+		description = strings.TrimSpace(description + "\n\nTel: " + ev.Phone)
+	}
+	if description != "" {
+		b.line("DESCRIPTION:" + escapeText(description))
+	}
+	place := ev.Place
+	if place == "" {
+		place = ev.Phone
+	}
+	if place != "" {
+		b.line("LOCATION:" + escapeText(place))
+	}
+
+	b.line("ORGANIZER" + commonName(ev.Organizer) + ":mailto:" + ev.Organizer.Address)
+	for _, attendee := range ev.Attendees {
+		b.line("ATTENDEE" + commonName(attendee) +
+			";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:" + attendee.Address)
+	}
+
+	if ev.Method == CalendarCancel {
+		b.line("STATUS:CANCELLED")
+	} else {
+		b.line("STATUS:CONFIRMED")
+		// Recordatorio 15 minutos antes
+		b.line("BEGIN:VALARM")
+		b.line("TRIGGER:-PT15M")
+		b.line("ACTION:DISPLAY")
+		b.line("DESCRIPTION:" + escapeText(ev.Summary))
+		b.line("END:VALARM")
+	}
+	b.line("END:VEVENT")
+	b.line("END:VCALENDAR")
+
+	return b.Bytes(), nil
+}
+
+type icsWriter struct {
+	bytes.Buffer
+}
+
+// Escribe una línea de contenido plegándola a 75 octetos sin cortar runas UTF-8
+func (w *icsWriter) line(content string) {
+	width := 0
+	for _, r := range content {
+		size := len(string(r))
+		if width+size > 75 {
+			w.WriteString("\r\n ")
+			width = 1
+		}
+		w.WriteRune(r)
+		width += size
+	}
+	w.WriteString("\r\n")
+}
+
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+func commonName(addr *mail.Address) string {
+	if addr.Name == "" {
+		return ""
+	}
+	// Un valor entre comillas no admite DQUOTE ni caracteres de control;
+	// un salto de línea en el nombre agregaría propiedades al evento
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r == '"':
+			return '\''
+		case unicode.IsControl(r) && r != '\t':
+			return -1
+		}
+		return r
+	}, addr.Name)
+	return `;CN="` + name + `"`
+}
+
+func formatDateTime(property string, t time.Time, loc *time.Location) string {
+	if loc == time.UTC {
+		return property + ":" + t.UTC().Format("20060102T150405Z")
+	}
+	return property + ";TZID=" + loc.String() + ":" + t.In(loc).Format("20060102T150405")
+}
+
+// Escribe un VTIMEZONE con las transiciones de horario del año del evento y
+// del anterior (para cubrir el comienzo del año). Sin RRULE basta para un
+// evento puntual y evita depender de la base tz del cliente.
+func writeTimezone(b *icsWriter, loc *time.Location, at time.Time) {
+	year := at.In(loc).Year()
+	start := time.Date(year-1, time.January, 1, 0, 0, 0, 0, loc)
+	end := time.Date(year+1, time.January, 1, 0, 0, 0, 0, loc)
+
+	b.line("BEGIN:VTIMEZONE")
+	b.line("TZID:" + loc.String())
+
+	transitions := zoneTransitions(start, end)
+	if len(transitions) == 0 {
+		name, offset := start.Zone()
+		writeObservance(b, "STANDARD", start, name, offset, offset)
+	}
+	for _, tr := range transitions {
+		_, before := tr.Add(-time.Hour).Zone()
+		name, after := tr.Zone()
+		kind := "STANDARD"
+		if tr.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		writeObservance(b, kind, tr, name, before, after)
+	}
+
+	b.line("END:VTIMEZONE")
+}
+
+func writeObservance(b *icsWriter, kind string, start time.Time, name string, from int, to int) {
+	b.line("BEGIN:" + kind)
+	// DTSTART de la observancia se expresa en la hora local anterior al cambio
+	b.line("DTSTART:" + start.In(time.FixedZone("", from)).Format("20060102T150405"))
+	b.line("TZOFFSETFROM:" + formatOffset(from))
+	b.line("TZOFFSETTO:" + formatOffset(to))
+	if name != "" && !strings.HasPrefix(name, "+") && !strings.HasPrefix(name, "-") {
+		b.line("TZNAME:" + name)
+	}
+	b.line("END:" + kind)
+}
+
+// Busca los instantes en que cambia el offset, primero por día y luego por minuto
+func zoneTransitions(start time.Time, end time.Time) []time.Time {
+	var transitions []time.Time
+	_, offset := start.Zone()
+	for day := start; day.Before(end); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+		if _, o := next.Zone(); o == offset {
+			continue
+		}
+		for t := day; t.Before(next); t = t.Add(time.Minute) {
+			if _, o := t.Zone(); o != offset {
+				transitions = append(transitions, t)
+				offset = o
+				break
+			}
+		}
+	}
+	return transitions
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
@@ -0,0 +1,101 @@
+package mail
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent(t *testing.T) Event {
+	loc, err := time.LoadLocation("America/Santiago")
+	require.NoError(t, err)
+	start := time.Date(2024, time.June, 10, 15, 0, 0, 0, loc)
+	return Event{
+		UID:         "abc123@email-api",
+		Method:      CalendarRequest,
+		Organizer:   &mail.Address{Name: "Tienda", Address: "ventas@tienda.com"},
+		Attendees:   []*mail.Address{{Name: "Juan", Address: "juan@ejemplo.com"}},
+		Start:       start,
+		End:         start.Add(30 * time.Minute),
+		TimeZone:    loc,
+		Summary:     "Demo; productos, nuevos",
+		Description: "Revisaremos el catálogo de invierno con todos los productos nuevos y las ofertas especiales",
+		Phone:       "+56912345678",
+		Stamp:       time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestEventICS(t *testing.T) {
+	ics, err := testEvent(t).ICS()
+	require.NoError(t, err)
+	out := string(ics)
+
+	require.True(t, strings.HasSuffix(out, "END:VCALENDAR\r\n"))
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		require.LessOrEqual(t, len(line), 75, line)
+	}
+	require.NotContains(t, strings.ReplaceAll(out, "\r\n", ""), "\n")
+
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	require.Contains(t, unfolded, "METHOD:REQUEST\r\n")
+	require.Contains(t, unfolded, `SUMMARY:Demo\; productos\, nuevos`)
+	require.Contains(t, unfolded, `\n\nTel: +56912345678`)
+	require.Contains(t, unfolded, "DTSTART;TZID=America/Santiago:20240610T150000\r\n")
+	require.Contains(t, unfolded, "DTSTAMP:20240601T120000Z\r\n")
+	require.Contains(t, unfolded, `ATTENDEE;CN="Juan";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:juan@ejemplo.com`)
+	require.Contains(t, unfolded, "STATUS:CONFIRMED\r\n")
+	require.Contains(t, unfolded, "TRIGGER:-PT15M\r\n")
+
+	// Chile cambia de horario en abril y septiembre
+	require.Contains(t, unfolded, "TZID:America/Santiago\r\n")
+	require.Contains(t, unfolded, "BEGIN:STANDARD\r\n")
+	require.Contains(t, unfolded, "BEGIN:DAYLIGHT\r\n")
+	require.Contains(t, unfolded, "TZOFFSETFROM:-0300\r\nTZOFFSETTO:-0400\r\n")
+}
+
+func TestEventICSCancel(t *testing.T) {
+	ev := testEvent(t)
+	ev.Method = CalendarCancel
+	ev.Sequence = 2
+
+	ics, err := ev.ICS()
+	require.NoError(t, err)
+	out := string(ics)
+	require.Contains(t, out, "METHOD:CANCEL\r\n")
+	require.Contains(t, out, "SEQUENCE:2\r\n")
+	require.Contains(t, out, "STATUS:CANCELLED\r\n")
+	require.NotContains(t, out, "VALARM")
+	require.Equal(t, "text/calendar; charset=UTF-8; method=CANCEL", ev.ContentType())
+}
+
+func TestEventICSSanitizesCommonName(t *testing.T) {
+	ev := testEvent(t)
+	ev.Attendees = []*mail.Address{{Name: "Juan \"JP\"\r\nATTENDEE:mailto:intruso@ejemplo.com\x00", Address: "juan@ejemplo.com"}}
+
+	ics, err := ev.ICS()
+	require.NoError(t, err)
+	unfolded := strings.ReplaceAll(string(ics), "\r\n ", "")
+	require.Contains(t, unfolded, `ATTENDEE;CN="Juan 'JP'ATTENDEE:mailto:intruso@ejemplo.com";ROLE=REQ-PARTICIPANT`)
+	require.NotContains(t, unfolded, "\r\nATTENDEE:mailto:intruso")
+	require.NotContains(t, unfolded, "\x00")
+}
+
+func TestEventICSValidation(t *testing.T) {
+	tests := map[string]func(*Event){
+		"sin UID":         func(ev *Event) { ev.UID = "" },
+		"sin asistentes":  func(ev *Event) { ev.Attendees = nil },
+		"fin antes":       func(ev *Event) { ev.End = ev.Start.Add(-time.Hour) },
+		"método inválido": func(ev *Event) { ev.Method = "PUBLISH" },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			ev := testEvent(t)
+			mutate(&ev)
+			_, err := ev.ICS()
+			require.Error(t, err)
+		})
+	}
+}
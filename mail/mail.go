@@ -1,20 +1,26 @@
 package mail
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/mail"
 	"net/smtp"
 	"time"
-
-	"github.com/jordan-wright/email"
 )
 
-const (
-	smtpAuthAdress = "smtp.gmail.com"
-	smtpServerAuth = "smtp.gmail.com:587"
-)
+const smtpServerAuth = "smtp.gmail.com:587"
+
+// Tiempo máximo de envío cuando se usa SendEmail sin contexto
+const defaultSendTimeout = 30 * time.Second
 
 type EmailSender interface {
+	// Send respeta la cancelación y el deadline de ctx en el dial,
+	// el handshake TLS y los comandos SMTP
+	Send(ctx context.Context, msg Message) error
+	// SendEmail se mantiene por compatibilidad; usa Send con un timeout de 30s
 	SendEmail(
 		subject string,
 		body string,
@@ -29,14 +35,82 @@ type GmailSender struct {
 	name              string
 	fromEmailAdress   string
 	fromEmailPassword string
+	smtpServer        string
+	auth              smtp.Auth
+	transport         Transport
+	dkim              *DKIMSigner
+}
+
+// Option configura parámetros opcionales del GmailSender
+type Option func(*GmailSender)
+
+// WithServer cambia el servidor SMTP (host:puerto), por ejemplo para Microsoft 365
+func WithServer(addr string) Option {
+	return func(sender *GmailSender) {
+		sender.smtpServer = addr
+	}
+}
+
+// WithAuth reemplaza la autenticación PLAIN con contraseña de aplicación (por ejemplo por XOAUTH2)
+func WithAuth(auth smtp.Auth) Option {
+	return func(sender *GmailSender) {
+		sender.auth = auth
+	}
 }
 
-func NewGmailSender(name string, fromEmailAdress string, fromEmailPassword string) EmailSender {
-	return &GmailSender{
+// WithTransport envía a través de un transporte propio, por ejemplo un SMTPPool compartido
+func WithTransport(transport Transport) Option {
+	return func(sender *GmailSender) {
+		sender.transport = transport
+	}
+}
+
+// WithDKIM firma los mensajes con DKIM antes de enviarlos
+func WithDKIM(signer *DKIMSigner) Option {
+	return func(sender *GmailSender) {
+		sender.dkim = signer
+	}
+}
+
+func NewGmailSender(name string, fromEmailAdress string, fromEmailPassword string, opts ...Option) EmailSender {
+	sender := &GmailSender{
 		name:              name,
 		fromEmailAdress:   fromEmailAdress,
 		fromEmailPassword: fromEmailPassword,
+		smtpServer:        smtpServerAuth,
+	}
+	for _, opt := range opts {
+		opt(sender)
+	}
+	if sender.auth == nil {
+		host, _, _ := net.SplitHostPort(sender.smtpServer)
+		sender.auth = smtp.PlainAuth("", sender.fromEmailAdress, sender.fromEmailPassword, host)
+	}
+	if sender.transport == nil {
+		sender.transport = &directTransport{addr: sender.smtpServer, auth: sender.auth}
 	}
+	return sender
+}
+
+// Verifier comprueba la conexión y las credenciales sin enviar un mensaje
+type Verifier interface {
+	Verify(ctx context.Context) error
+}
+
+// Verify abre una sesión SMTP nueva (dial, EHLO, STARTTLS y AUTH) y la cierra.
+// No usa el transporte configurado para no ocupar una conexión del pool, y
+// sus etapas no llegan al PhaseObserver.
+func (sender *GmailSender) Verify(ctx context.Context) error {
+	ctx = withProbe(ctx)
+	client, conn, err := dialSMTP(ctx, sender.smtpServer, sender.auth, nil)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	release := bindContext(ctx, conn)
+	defer release()
+	return contextError(ctx, client.Quit())
 }
 
 func (sender *GmailSender) SendEmail(
@@ -47,47 +121,64 @@ func (sender *GmailSender) SendEmail(
 	bcc []string,
 	attachFiles []string,
 ) error {
-	log.Printf("📧 Iniciando envío de email a: %v", to)
-	
-	e := email.NewEmail()
-	e.From = fmt.Sprintf("%s <%s>", sender.name, sender.fromEmailAdress)
-	e.Subject = subject
-	e.HTML = []byte(body)
-	e.To = to
-	e.Cc = cc
-	e.Bcc = bcc
-
-	log.Printf("📎 Adjuntando %d archivos...", len(attachFiles))
-	for _, f := range attachFiles {
-		_, err := e.AttachFile(f)
-		if err != nil {
-			return fmt.Errorf("error attaching file: %s", err)
-		}
+	msg, err := NewMessage().
+		To(to...).
+		Cc(cc...).
+		Bcc(bcc...).
+		Subject(subject).
+		HTML(body).
+		AttachFile(attachFiles...).
+		Build()
+	if err != nil {
+		return err
 	}
 
-	log.Println("🔐 Configurando autenticación SMTP...")
-	smptpAuth := smtp.PlainAuth("", sender.fromEmailAdress, sender.fromEmailPassword, smtpAuthAdress)
-
-	log.Printf("📡 Conectando a servidor SMTP: %s", smtpServerAuth)
-	
-	// Crear un canal para manejar el timeout
-	done := make(chan error, 1)
-	
-	go func() {
-		done <- e.Send(smtpServerAuth, smptpAuth)
-	}()
-	
-	// Esperar por el resultado o timeout
-	select {
-	case err := <-done:
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSendTimeout)
+	defer cancel()
+	return sender.Send(ctx, msg)
+}
+
+func (sender *GmailSender) Send(ctx context.Context, msg Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	recipients := msg.recipients()
+	slog.DebugContext(ctx, "iniciando envío",
+		"recipients", recipients,
+		"attachments", len(msg.Attachments),
+		"tags", msg.Tags)
+
+	e, err := msg.toEmail(&mail.Address{Name: sender.name, Address: sender.fromEmailAdress})
+	if err != nil {
+		return err
+	}
+
+	raw, err := msg.bytes(e)
+	if err != nil {
+		return fmt.Errorf("error building message: %s", err)
+	}
+
+	if sender.dkim != nil {
+		slog.DebugContext(ctx, "firmando mensaje con DKIM")
+		raw, err = sender.dkim.Sign(e.From, raw)
 		if err != nil {
-			log.Printf("❌ Error SMTP: %v", err)
 			return err
 		}
-		log.Println("✅ Email enviado exitosamente por SMTP")
-		return nil
-	case <-time.After(30 * time.Second):
-		log.Println("⏰ Timeout al enviar email (30s)")
-		return fmt.Errorf("timeout sending email after 30 seconds")
 	}
+
+	slog.DebugContext(ctx, "conectando al servidor SMTP", "server", sender.smtpServer)
+	err = sender.transport.Send(ctx, sender.fromEmailAdress, recipients, raw)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			slog.WarnContext(ctx, "timeout al enviar el correo", "server", sender.smtpServer, "error", err)
+		} else {
+			slog.ErrorContext(ctx, "error SMTP", "server", sender.smtpServer, "error", err)
+		}
+		return err
+	}
+	slog.InfoContext(ctx, "correo enviado por SMTP",
+		"recipients", len(recipients),
+		"size", len(raw),
+		"tags", msg.Tags)
+	return nil
 }
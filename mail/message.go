@@ -0,0 +1,396 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jordan-wright/email"
+)
+
+// Priority se traduce en las cabeceras X-Priority e Importance
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+	PriorityLow
+)
+
+// Attachment es un adjunto en memoria. Si Inline es true la parte se envía
+// como multipart/related y el HTML puede referenciarla con cid:ContentID.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+	Inline      bool
+	ContentID   string
+}
+
+// CalendarPart es un objeto iCalendar que viaja como alternativa
+// text/calendar del cuerpo, que es donde Gmail y Outlook lo buscan para
+// mostrar los botones de aceptar y rechazar
+type CalendarPart struct {
+	Method  CalendarMethod
+	Content []byte
+}
+
+// Message describe un correo completo independientemente del transporte
+type Message struct {
+	// Si From es nil se usa el remitente configurado en el EmailSender
+	From    *mail.Address
+	ReplyTo []*mail.Address
+	To      []*mail.Address
+	Cc      []*mail.Address
+	Bcc     []*mail.Address
+
+	Subject     string
+	HTML        string
+	Text        string
+	Headers     map[string]string
+	Attachments []Attachment
+	Priority    Priority
+	Calendar    *CalendarPart
+
+	// Tags y Metadata no se envían al destinatario; sirven para logs y métricas
+	Tags     []string
+	Metadata map[string]string
+}
+
+// Validate verifica que el mensaje se pueda enviar
+func (m Message) Validate() error {
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return errors.New("at least one recipient is required")
+	}
+	for _, a := range m.Attachments {
+		if a.Inline && a.ContentID == "" {
+			return fmt.Errorf("inline attachment %q requires a content ID", a.Filename)
+		}
+		if a.Inline && m.HTML == "" {
+			return errors.New("inline attachments require an HTML body")
+		}
+		if a.Inline && m.Calendar != nil {
+			return errors.New("inline attachments are not supported with a calendar part")
+		}
+	}
+	return nil
+}
+
+// Direcciones del sobre SMTP (To, Cc y Bcc)
+func (m Message) recipients() []string {
+	recipients := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	for _, list := range [][]*mail.Address{m.To, m.Cc, m.Bcc} {
+		for _, addr := range list {
+			recipients = append(recipients, addr.Address)
+		}
+	}
+	return recipients
+}
+
+// Construye el email MIME usando from si el mensaje no define remitente
+func (m Message) toEmail(from *mail.Address) (*email.Email, error) {
+	if m.From != nil {
+		from = m.From
+	}
+
+	e := email.NewEmail()
+	e.From = from.String()
+	e.ReplyTo = formatAddresses(m.ReplyTo)
+	e.To = formatAddresses(m.To)
+	e.Cc = formatAddresses(m.Cc)
+	e.Bcc = formatAddresses(m.Bcc)
+	e.Subject = m.Subject
+	if m.HTML != "" {
+		e.HTML = []byte(m.HTML)
+	}
+	if m.Text != "" {
+		e.Text = []byte(m.Text)
+	}
+
+	for key, value := range m.Headers {
+		e.Headers.Set(key, value)
+	}
+	switch m.Priority {
+	case PriorityHigh:
+		e.Headers.Set("X-Priority", "1 (Highest)")
+		e.Headers.Set("Importance", "high")
+	case PriorityLow:
+		e.Headers.Set("X-Priority", "5 (Lowest)")
+		e.Headers.Set("Importance", "low")
+	}
+
+	for _, a := range m.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(a.Filename))
+		}
+		at, err := e.Attach(bytes.NewReader(a.Content), a.Filename, contentType)
+		if err != nil {
+			return nil, fmt.Errorf("error attaching file: %s", err)
+		}
+		if a.Inline {
+			at.HTMLRelated = true
+			at.Header.Set("Content-ID", fmt.Sprintf("<%s>", a.ContentID))
+		}
+	}
+
+	return e, nil
+}
+
+// MIME del mensaje. Con invitación el cuerpo se arma aquí porque la librería
+// solo admite texto y HTML en multipart/alternative.
+func (m Message) bytes(e *email.Email) ([]byte, error) {
+	if m.Calendar == nil {
+		return e.Bytes()
+	}
+
+	// Solo las cabeceras: sin cuerpo la librería escribe un text/plain vacío
+	headersOnly := *e
+	headersOnly.Text, headersOnly.HTML, headersOnly.Attachments = nil, nil, nil
+	raw, err := headersOnly.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	head, _, _ := bytes.Cut(raw, []byte("\r\n\r\n"))
+
+	var buf bytes.Buffer
+	for _, line := range strings.Split(string(head), "\r\n") {
+		if strings.HasPrefix(line, "Content-Type:") || strings.HasPrefix(line, "Content-Transfer-Encoding:") {
+			continue
+		}
+		buf.WriteString(line + "\r\n")
+	}
+
+	alternative := multipart.NewWriter(&buf)
+	alternativeType := "multipart/alternative;\r\n boundary=" + alternative.Boundary()
+	var mixed *multipart.Writer
+	if len(e.Attachments) > 0 {
+		mixed = multipart.NewWriter(&buf)
+		fmt.Fprintf(&buf, "Content-Type: multipart/mixed;\r\n boundary=%s\r\n\r\n", mixed.Boundary())
+		if _, err := mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {alternativeType}}); err != nil {
+			return nil, err
+		}
+	} else {
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n\r\n", alternativeType)
+	}
+
+	// Los clientes muestran la última alternativa que entienden
+	bodies := []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=UTF-8", e.Text},
+		{"text/html; charset=UTF-8", e.HTML},
+		{fmt.Sprintf("text/calendar; charset=UTF-8; method=%s", m.Calendar.Method), m.Calendar.Content},
+	}
+	for _, body := range bodies {
+		if len(body.content) == 0 {
+			continue
+		}
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write(body.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+
+	if mixed == nil {
+		return buf.Bytes(), nil
+	}
+	for _, a := range e.Attachments {
+		header := textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		}
+		part, err := mixed.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(a.Content)
+		for len(encoded) > 76 {
+			io.WriteString(part, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(part, encoded+"\r\n")
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatAddresses(addrs []*mail.Address) []string {
+	if len(addrs) == 0 {
+		return nil
+	}
+	formatted := make([]string, len(addrs))
+	for i, addr := range addrs {
+		formatted[i] = addr.String()
+	}
+	return formatted
+}
+
+// MessageBuilder arma un Message acumulando los errores de parseo hasta Build
+type MessageBuilder struct {
+	msg  Message
+	errs []error
+}
+
+func NewMessage() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+func (b *MessageBuilder) parse(addrs []string) []*mail.Address {
+	var parsed []*mail.Address
+	for _, addr := range addrs {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			b.errs = append(b.errs, fmt.Errorf("invalid address %q: %s", addr, err))
+			continue
+		}
+		parsed = append(parsed, a)
+	}
+	return parsed
+}
+
+func (b *MessageBuilder) From(addr string) *MessageBuilder {
+	if parsed := b.parse([]string{addr}); len(parsed) == 1 {
+		b.msg.From = parsed[0]
+	}
+	return b
+}
+
+func (b *MessageBuilder) ReplyTo(addrs ...string) *MessageBuilder {
+	b.msg.ReplyTo = append(b.msg.ReplyTo, b.parse(addrs)...)
+	return b
+}
+
+func (b *MessageBuilder) To(addrs ...string) *MessageBuilder {
+	b.msg.To = append(b.msg.To, b.parse(addrs)...)
+	return b
+}
+
+func (b *MessageBuilder) Cc(addrs ...string) *MessageBuilder {
+	b.msg.Cc = append(b.msg.Cc, b.parse(addrs)...)
+	return b
+}
+
+func (b *MessageBuilder) Bcc(addrs ...string) *MessageBuilder {
+	b.msg.Bcc = append(b.msg.Bcc, b.parse(addrs)...)
+	return b
+}
+
+func (b *MessageBuilder) Subject(subject string) *MessageBuilder {
+	b.msg.Subject = subject
+	return b
+}
+
+func (b *MessageBuilder) HTML(html string) *MessageBuilder {
+	b.msg.HTML = html
+	return b
+}
+
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	b.msg.Text = text
+	return b
+}
+
+func (b *MessageBuilder) Header(key string, value string) *MessageBuilder {
+	if b.msg.Headers == nil {
+		b.msg.Headers = make(map[string]string)
+	}
+	b.msg.Headers[key] = value
+	return b
+}
+
+func (b *MessageBuilder) Priority(priority Priority) *MessageBuilder {
+	b.msg.Priority = priority
+	return b
+}
+
+func (b *MessageBuilder) Attach(filename string, contentType string, content []byte) *MessageBuilder {
+	b.msg.Attachments = append(b.msg.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Content:     content,
+	})
+	return b
+}
+
+// Calendar agrega la invitación como alternativa text/calendar del cuerpo
+func (b *MessageBuilder) Calendar(method CalendarMethod, ics []byte) *MessageBuilder {
+	b.msg.Calendar = &CalendarPart{Method: method, Content: ics}
+	return b
+}
+
+// Inline agrega una imagen referenciable desde el HTML como cid:contentID
+func (b *MessageBuilder) Inline(contentID string, filename string, contentType string, content []byte) *MessageBuilder {
+	b.msg.Attachments = append(b.msg.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Content:     content,
+		Inline:      true,
+		ContentID:   contentID,
+	})
+	return b
+}
+
+// AttachFile lee adjuntos desde el sistema de archivos
+func (b *MessageBuilder) AttachFile(paths ...string) *MessageBuilder {
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			b.errs = append(b.errs, fmt.Errorf("error attaching file: %s", err))
+			continue
+		}
+		b.Attach(filepath.Base(path), mime.TypeByExtension(filepath.Ext(path)), content)
+	}
+	return b
+}
+
+func (b *MessageBuilder) Tag(tags ...string) *MessageBuilder {
+	b.msg.Tags = append(b.msg.Tags, tags...)
+	return b
+}
+
+func (b *MessageBuilder) Meta(key string, value string) *MessageBuilder {
+	if b.msg.Metadata == nil {
+		b.msg.Metadata = make(map[string]string)
+	}
+	b.msg.Metadata[key] = value
+	return b
+}
+
+// Build devuelve el mensaje o todos los errores encontrados al armarlo
+func (b *MessageBuilder) Build() (Message, error) {
+	if len(b.errs) > 0 {
+		return Message{}, errors.Join(b.errs...)
+	}
+	if err := b.msg.Validate(); err != nil {
+		return Message{}, err
+	}
+	return b.msg, nil
+}
@@ -0,0 +1,147 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	msg, err := NewMessage().
+		From("Tienda <ventas@tienda.com>").
+		ReplyTo("soporte@tienda.com").
+		To("Juan <juan@ejemplo.com>", "ana@ejemplo.com").
+		Cc("jefe@ejemplo.com").
+		Bcc("archivo@tienda.com").
+		Subject("Tu factura").
+		HTML("<p>Adjuntamos tu factura</p><img src=\"cid:logo\">").
+		Text("Adjuntamos tu factura").
+		Header("X-Campaign", "invierno").
+		Priority(PriorityHigh).
+		Attach("factura.pdf", "application/pdf", []byte("%PDF-1.4")).
+		Inline("logo", "logo.png", "image/png", []byte("\x89PNG")).
+		Tag("factura").
+		Meta("order_id", "1234").
+		Build()
+	require.NoError(t, err)
+
+	require.Equal(t, "Juan", msg.To[0].Name)
+	require.Equal(t, []string{"juan@ejemplo.com", "ana@ejemplo.com", "jefe@ejemplo.com", "archivo@tienda.com"}, msg.recipients())
+
+	e, err := msg.toEmail(&mail.Address{Address: "default@tienda.com"})
+	require.NoError(t, err)
+	raw, err := e.Bytes()
+	require.NoError(t, err)
+
+	body := string(raw)
+	require.Contains(t, body, `From: "Tienda" <ventas@tienda.com>`)
+	require.Contains(t, body, "Reply-To: <soporte@tienda.com>")
+	require.Contains(t, body, "X-Campaign: invierno")
+	require.Contains(t, body, "X-Priority: 1 (Highest)")
+	require.Contains(t, body, "multipart/related")
+	require.Contains(t, body, "Content-Id: <logo>")
+	require.Contains(t, body, `filename="factura.pdf"`)
+	require.NotContains(t, body, "archivo@tienda.com")
+	require.NotContains(t, body, "order_id")
+}
+
+func TestMessageBuilderCollectsErrors(t *testing.T) {
+	_, err := NewMessage().
+		To("no es un correo", "ok@ejemplo.com").
+		Cc("tampoco").
+		AttachFile("/no/existe.pdf").
+		Build()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no es un correo")
+	require.Contains(t, err.Error(), "tampoco")
+	require.Contains(t, err.Error(), "error attaching file")
+
+	_, err = NewMessage().Subject("Sin destinatarios").Build()
+	require.ErrorContains(t, err, "at least one recipient")
+
+	_, err = NewMessage().To("a@b.com").Text("solo texto").Inline("logo", "logo.png", "image/png", nil).Build()
+	require.ErrorContains(t, err, "HTML body")
+}
+
+func TestMessageBuilderAttachFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalogo.txt")
+	require.NoError(t, os.WriteFile(path, []byte("catálogo"), 0o600))
+
+	msg, err := NewMessage().To("a@b.com").AttachFile(path).Build()
+	require.NoError(t, err)
+	require.Len(t, msg.Attachments, 1)
+	require.Equal(t, "catalogo.txt", msg.Attachments[0].Filename)
+	require.True(t, strings.HasPrefix(msg.Attachments[0].ContentType, "text/plain"))
+}
+
+func TestMessageCalendarPart(t *testing.T) {
+	ics := []byte("BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nEND:VCALENDAR\r\n")
+	msg, err := NewMessage().
+		To("juan@ejemplo.com").
+		Subject("Invitación: Demo").
+		HTML("<p>Demo</p>").
+		Text("Demo").
+		Calendar(CalendarRequest, ics).
+		Attach("invite.ics", "text/calendar; charset=UTF-8; method=REQUEST", ics).
+		Build()
+	require.NoError(t, err)
+
+	e, err := msg.toEmail(&mail.Address{Address: "agenda@tienda.com"})
+	require.NoError(t, err)
+	raw, err := msg.bytes(e)
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	require.Equal(t, "<juan@ejemplo.com>", parsed.Header.Get("To"))
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+
+	// mixed: alternative (texto, HTML, calendario) + el .ics adjunto
+	mixed := multipart.NewReader(parsed.Body, params["boundary"])
+	part, err := mixed.NextPart()
+	require.NoError(t, err)
+	mediaType, params, err = mime.ParseMediaType(part.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	var types []string
+	alternative := multipart.NewReader(part, params["boundary"])
+	for {
+		body, err := alternative.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, body.Header.Get("Content-Type"))
+		if strings.HasPrefix(body.Header.Get("Content-Type"), "text/calendar") {
+			content, err := io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, ics, content)
+		}
+	}
+	require.Equal(t, []string{
+		"text/plain; charset=UTF-8",
+		"text/html; charset=UTF-8",
+		"text/calendar; charset=UTF-8; method=REQUEST",
+	}, types)
+
+	attachment, err := mixed.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "invite.ics", attachment.FileName())
+	_, err = mixed.NextPart()
+	require.Equal(t, io.EOF, err)
+
+	_, err = NewMessage().To("a@b.com").HTML("<img src=\"cid:logo\">").Calendar(CalendarRequest, ics).
+		Inline("logo", "logo.png", "image/png", nil).Build()
+	require.ErrorContains(t, err, "calendar part")
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// SMTPPhase es una etapa del envío SMTP
+type SMTPPhase string
+
+const (
+	// Conexión TCP con el servidor
+	PhaseDial SMTPPhase = "dial"
+	// EHLO, STARTTLS y AUTH
+	PhaseHandshake SMTPPhase = "handshake"
+	// MAIL FROM, RCPT TO y DATA
+	PhaseSend SMTPPhase = "send"
+)
+
+// PhaseObserver se llama al comenzar cada etapa; la función que devuelve se
+// llama al terminarla con su error. Sirve para métricas y trazas.
+type PhaseObserver func(ctx context.Context, phase SMTPPhase) func(err error)
+
+var phaseObserver atomic.Pointer[PhaseObserver]
+
+// SetPhaseObserver registra el observador de las etapas SMTP de todos los
+// transportes; nil lo quita
+func SetPhaseObserver(observer PhaseObserver) {
+	if observer == nil {
+		phaseObserver.Store(nil)
+		return
+	}
+	phaseObserver.Store(&observer)
+}
+
+// Las pruebas de conexión de Verify no son envíos: no pasan por el observador
+// para no mezclarse con las métricas y trazas de los correos
+type probeKey struct{}
+
+func withProbe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, probeKey{}, true)
+}
+
+func observePhase(ctx context.Context, phase SMTPPhase) func(err error) {
+	if probe, _ := ctx.Value(probeKey{}).(bool); probe {
+		return func(error) {}
+	}
+	if observer := phaseObserver.Load(); observer != nil {
+		return (*observer)(ctx, phase)
+	}
+	return func(error) {}
+}
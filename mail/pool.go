@@ -0,0 +1,207 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"sync"
+	"time"
+)
+
+var ErrPoolClosed = errors.New("smtp pool closed")
+
+// PoolConfig configura el pool de conexiones SMTP
+type PoolConfig struct {
+	Addr      string
+	Auth      smtp.Auth
+	TLSConfig *tls.Config
+
+	// Máximo de conexiones simultáneas (por defecto 4)
+	MaxConns int
+	// Tiempo que una conexión puede estar ociosa antes de cerrarse (por defecto 30s)
+	IdleTimeout time.Duration
+	// Mensajes por sesión antes de reconectar (por defecto 100)
+	MaxMessagesPerConn int
+}
+
+type pooledConn struct {
+	client   *smtp.Client
+	conn     net.Conn
+	lastUsed time.Time
+	sent     int
+}
+
+// Cierra la sesión con QUIT sin quedar bloqueado si el servidor no responde
+func (c *pooledConn) quit() {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c.client.Quit()
+}
+
+// SMTPPool mantiene sesiones SMTP autenticadas abiertas y las reutiliza entre
+// envíos, separando los mensajes con RSET. Implementa Transport.
+type SMTPPool struct {
+	config PoolConfig
+	sem    chan struct{}
+	stop   chan struct{}
+
+	mu     sync.Mutex
+	idle   []*pooledConn
+	closed bool
+}
+
+func NewSMTPPool(config PoolConfig) *SMTPPool {
+	if config.MaxConns <= 0 {
+		config.MaxConns = 4
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = 30 * time.Second
+	}
+	if config.MaxMessagesPerConn <= 0 {
+		config.MaxMessagesPerConn = 100
+	}
+
+	pool := &SMTPPool{
+		config: config,
+		sem:    make(chan struct{}, config.MaxConns),
+		stop:   make(chan struct{}),
+	}
+	go pool.reapIdle()
+	return pool
+}
+
+func (p *SMTPPool) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.sem }()
+
+	conn, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	release := bindContext(ctx, conn.conn)
+	done := observePhase(ctx, PhaseSend)
+	err = deliver(conn.client, from, to, msg)
+	if alive := release(); err != nil || !alive {
+		// Ante cualquier error o cancelación la sesión queda en estado desconocido: se descarta
+		conn.client.Close()
+		if err == nil {
+			err = ctx.Err()
+		}
+		err = contextError(ctx, err)
+		done(err)
+		return err
+	}
+	done(nil)
+
+	conn.sent++
+	conn.lastUsed = time.Now()
+	p.put(conn)
+	return nil
+}
+
+// Close cierra las conexiones ociosas; los envíos en curso terminan normalmente
+func (p *SMTPPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	close(p.stop)
+	for _, conn := range idle {
+		conn.quit()
+	}
+	return nil
+}
+
+// Obtiene una conexión ociosa sana o abre una nueva
+func (p *SMTPPool) get(ctx context.Context) (*pooledConn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if time.Since(conn.lastUsed) > p.config.IdleTimeout {
+			conn.client.Close()
+			continue
+		}
+		// RSET limpia la transacción anterior y verifica que la sesión siga viva
+		release := bindContext(ctx, conn.conn)
+		err := conn.client.Reset()
+		if alive := release(); err != nil || !alive {
+			conn.client.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		return conn, nil
+	}
+
+	client, netConn, err := dialSMTP(ctx, p.config.Addr, p.config.Auth, p.config.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledConn{client: client, conn: netConn, lastUsed: time.Now()}, nil
+}
+
+func (p *SMTPPool) put(conn *pooledConn) {
+	p.mu.Lock()
+	if p.closed || conn.sent >= p.config.MaxMessagesPerConn {
+		p.mu.Unlock()
+		conn.quit()
+		return
+	}
+	p.idle = append(p.idle, conn)
+	p.mu.Unlock()
+}
+
+// Cierra periódicamente las conexiones que superaron el tiempo ocioso
+func (p *SMTPPool) reapIdle() {
+	ticker := time.NewTicker(p.config.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var stale []*pooledConn
+		p.mu.Lock()
+		fresh := p.idle[:0]
+		for _, conn := range p.idle {
+			if time.Since(conn.lastUsed) > p.config.IdleTimeout {
+				stale = append(stale, conn)
+			} else {
+				fresh = append(fresh, conn)
+			}
+		}
+		p.idle = fresh
+		p.mu.Unlock()
+
+		for _, conn := range stale {
+			conn.quit()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var poolTestMessage = []byte("Subject: Hola\r\n\r\nMensaje de prueba\r\n")
+
+func stubAuth(stub *smtpStub) smtp.Auth {
+	host, _, _ := net.SplitHostPort(stub.Addr())
+	return smtp.PlainAuth("", "ventas@tienda.com", "secret", host)
+}
+
+func TestSMTPPoolReusesConnections(t *testing.T) {
+	stub := newSMTPStub(t)
+	pool := NewSMTPPool(PoolConfig{Addr: stub.Addr(), Auth: stubAuth(stub), MaxConns: 1})
+	defer pool.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, pool.Send(context.Background(), "ventas@tienda.com", []string{"cliente@ejemplo.com"}, poolTestMessage))
+	}
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&stub.connections))
+	require.Equal(t, int32(10), atomic.LoadInt32(&stub.messages))
+	require.Equal(t, int32(9), atomic.LoadInt32(&stub.resets))
+}
+
+func TestSMTPPoolCapsConcurrentConnections(t *testing.T) {
+	stub := newSMTPStub(t)
+	pool := NewSMTPPool(PoolConfig{Addr: stub.Addr(), Auth: stubAuth(stub), MaxConns: 3})
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, pool.Send(context.Background(), "ventas@tienda.com", []string{"cliente@ejemplo.com"}, poolTestMessage))
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(30), atomic.LoadInt32(&stub.messages))
+	require.LessOrEqual(t, atomic.LoadInt32(&stub.maxActive), int32(3))
+}
+
+func TestSMTPPoolRecyclesBrokenConnections(t *testing.T) {
+	stub := newSMTPStub(t)
+	atomic.StoreInt32(&stub.failAfter, 2)
+	pool := NewSMTPPool(PoolConfig{Addr: stub.Addr(), Auth: stubAuth(stub), MaxConns: 1})
+	defer pool.Close()
+
+	require.NoError(t, pool.Send(context.Background(), "ventas@tienda.com", []string{"a@ejemplo.com"}, poolTestMessage))
+	require.Error(t, pool.Send(context.Background(), "ventas@tienda.com", []string{"b@ejemplo.com"}, poolTestMessage))
+	require.NoError(t, pool.Send(context.Background(), "ventas@tienda.com", []string{"c@ejemplo.com"}, poolTestMessage))
+
+	require.Equal(t, int32(2), atomic.LoadInt32(&stub.connections))
+}
+
+func TestSMTPPoolDropsIdleConnections(t *testing.T) {
+	stub := newSMTPStub(t)
+	pool := NewSMTPPool(PoolConfig{Addr: stub.Addr(), Auth: stubAuth(stub), IdleTimeout: 50 * time.Millisecond})
+	defer pool.Close()
+
+	require.NoError(t, pool.Send(context.Background(), "ventas@tienda.com", []string{"a@ejemplo.com"}, poolTestMessage))
+	time.Sleep(150 * time.Millisecond)
+	require.NoError(t, pool.Send(context.Background(), "ventas@tienda.com", []string{"b@ejemplo.com"}, poolTestMessage))
+
+	require.Equal(t, int32(2), atomic.LoadInt32(&stub.connections))
+}
+
+func TestSMTPPoolClosed(t *testing.T) {
+	stub := newSMTPStub(t)
+	pool := NewSMTPPool(PoolConfig{Addr: stub.Addr(), Auth: stubAuth(stub)})
+	require.NoError(t, pool.Close())
+
+	require.ErrorIs(t, pool.Send(context.Background(), "ventas@tienda.com", []string{"a@ejemplo.com"}, poolTestMessage), ErrPoolClosed)
+}
+
+func BenchmarkDirectTransport(b *testing.B) {
+	stub := newSMTPStub(b)
+	transport := &directTransport{addr: stub.Addr(), auth: stubAuth(stub)}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := transport.Send(context.Background(), "ventas@tienda.com", []string{"cliente@ejemplo.com"}, poolTestMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSMTPPool(b *testing.B) {
+	stub := newSMTPStub(b)
+	pool := NewSMTPPool(PoolConfig{Addr: stub.Addr(), Auth: stubAuth(stub), MaxConns: 4})
+	defer pool.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := pool.Send(context.Background(), "ventas@tienda.com", []string{"cliente@ejemplo.com"}, poolTestMessage); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSMTPPoolSequential(b *testing.B) {
+	stub := newSMTPStub(b)
+	pool := NewSMTPPool(PoolConfig{Addr: stub.Addr(), Auth: stubAuth(stub), MaxConns: 1})
+	defer pool.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := pool.Send(context.Background(), "ventas@tienda.com", []string{"cliente@ejemplo.com"}, poolTestMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package mail
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// smtpStub es un servidor SMTP mínimo en 127.0.0.1 para tests y benchmarks.
+// Acepta AUTH PLAIN sin TLS (net/smtp lo permite hacia localhost).
+type smtpStub struct {
+	listener net.Listener
+
+	connections int32
+	active      int32
+	maxActive   int32
+	messages    int32
+	resets      int32
+
+	// Si failAfter > 0, la conexión se corta tras ese número de mensajes
+	failAfter int32
+	// Si stallData != 0, el servidor nunca confirma el DATA
+	stallData int32
+	// Si rejectAuth != 0, el AUTH falla como con una contraseña incorrecta
+	rejectAuth int32
+	closed     int32
+
+	mu       sync.Mutex
+	received [][]byte
+}
+
+func newSMTPStub(t testing.TB) *smtpStub {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &smtpStub{listener: listener}
+	go stub.serve()
+	t.Cleanup(func() { listener.Close() })
+	return stub
+}
+
+func (s *smtpStub) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *smtpStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStub) handle(conn net.Conn) {
+	defer atomic.AddInt32(&s.closed, 1)
+	defer conn.Close()
+	atomic.AddInt32(&s.connections, 1)
+	active := atomic.AddInt32(&s.active, 1)
+	defer atomic.AddInt32(&s.active, -1)
+	for {
+		peak := atomic.LoadInt32(&s.maxActive)
+		if active <= peak || atomic.CompareAndSwapInt32(&s.maxActive, peak, active) {
+			break
+		}
+	}
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 stub ESMTP")
+
+	sent := int32(0)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-stub")
+			reply("250-PIPELINING")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH"):
+			if atomic.LoadInt32(&s.rejectAuth) != 0 {
+				reply("535 5.7.8 Username and Password not accepted")
+				continue
+			}
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"), strings.HasPrefix(cmd, "NOOP"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RSET"):
+			atomic.AddInt32(&s.resets, 1)
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 Go ahead")
+			var data []byte
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data = append(data, l...)
+			}
+			if atomic.LoadInt32(&s.stallData) != 0 {
+				// Esperar hasta que el cliente cierre la conexión
+				r.ReadString('\n')
+				return
+			}
+			s.mu.Lock()
+			s.received = append(s.received, data)
+			s.mu.Unlock()
+			atomic.AddInt32(&s.messages, 1)
+			sent++
+			if fail := atomic.LoadInt32(&s.failAfter); fail > 0 && sent >= fail {
+				return
+			}
+			reply("250 OK queued")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
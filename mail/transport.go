@@ -0,0 +1,154 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// Transport entrega un mensaje MIME ya construido a los destinatarios del sobre SMTP.
+// La cancelación o el deadline del contexto abortan la conexión en curso.
+type Transport interface {
+	Send(ctx context.Context, from string, to []string, msg []byte) error
+}
+
+// directTransport abre una conexión nueva por mensaje (comportamiento de smtp.SendMail)
+type directTransport struct {
+	addr string
+	auth smtp.Auth
+}
+
+func (t *directTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	client, conn, err := dialSMTP(ctx, t.addr, t.auth, nil)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	release := bindContext(ctx, conn)
+	defer release()
+
+	done := observePhase(ctx, PhaseSend)
+	if err := deliver(client, from, to, msg); err != nil {
+		err = contextError(ctx, err)
+		done(err)
+		return err
+	}
+	done(nil)
+	return contextError(ctx, client.Quit())
+}
+
+// Abre una sesión SMTP autenticada: EHLO, STARTTLS si está disponible y AUTH.
+// El contexto limita el dial, el handshake TLS y los comandos de la sesión.
+func dialSMTP(ctx context.Context, addr string, auth smtp.Auth, tlsConfig *tls.Config) (*smtp.Client, net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dialer net.Dialer
+	done := observePhase(ctx, PhaseDial)
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	done(err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	release := bindContext(ctx, conn)
+	defer release()
+
+	done = observePhase(ctx, PhaseHandshake)
+	client, err := handshakeSMTP(conn, host, auth, tlsConfig)
+	if err != nil {
+		conn.Close()
+		err = contextError(ctx, err)
+		done(err)
+		return nil, nil, err
+	}
+	done(nil)
+	return client, conn, nil
+}
+
+func handshakeSMTP(conn net.Conn, host string, auth smtp.Auth, tlsConfig *tls.Config) (*smtp.Client, error) {
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		config := &tls.Config{ServerName: host}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		if err := client.StartTLS(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return nil, fmt.Errorf("smtp: server doesn't support AUTH")
+		}
+		if err := client.Auth(auth); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// Aplica el deadline del contexto a la conexión y la cierra si el contexto se
+// cancela. La función devuelta quita el deadline y devuelve false si la
+// conexión ya fue abortada.
+func bindContext(ctx context.Context, conn net.Conn) func() bool {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	return func() bool {
+		alive := stop()
+		conn.SetDeadline(time.Time{})
+		return alive
+	}
+}
+
+// Si el contexto terminó, su error explica mejor la falla que el error de red.
+// El deadline de la conexión puede vencer un instante antes que el del contexto.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+// Envía un mensaje dentro de una sesión ya abierta
+func deliver(client *smtp.Client, from string, to []string, msg []byte) error {
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectTransportAbortsOnDeadline(t *testing.T) {
+	stub := newSMTPStub(t)
+	atomic.StoreInt32(&stub.stallData, 1)
+	transport := &directTransport{addr: stub.Addr(), auth: stubAuth(stub)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := transport.Send(ctx, "ventas@tienda.com", []string{"cliente@ejemplo.com"}, poolTestMessage)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 2*time.Second)
+
+	// La conexión se cierra en lugar de quedar colgada
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&stub.closed) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestDirectTransportAbortsOnCancel(t *testing.T) {
+	stub := newSMTPStub(t)
+	atomic.StoreInt32(&stub.stallData, 1)
+	transport := &directTransport{addr: stub.Addr(), auth: stubAuth(stub)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	err := transport.Send(ctx, "ventas@tienda.com", []string{"cliente@ejemplo.com"}, poolTestMessage)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&stub.closed) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestSMTPPoolDiscardsCancelledSession(t *testing.T) {
+	stub := newSMTPStub(t)
+	pool := NewSMTPPool(PoolConfig{Addr: stub.Addr(), Auth: stubAuth(stub), MaxConns: 1})
+	defer pool.Close()
+
+	atomic.StoreInt32(&stub.stallData, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, pool.Send(ctx, "ventas@tienda.com", []string{"a@ejemplo.com"}, poolTestMessage), context.DeadlineExceeded)
+
+	atomic.StoreInt32(&stub.stallData, 0)
+	require.NoError(t, pool.Send(context.Background(), "ventas@tienda.com", []string{"b@ejemplo.com"}, poolTestMessage))
+	require.Equal(t, int32(2), atomic.LoadInt32(&stub.connections))
+}
+
+func TestSMTPPoolWaitRespectsContext(t *testing.T) {
+	stub := newSMTPStub(t)
+	atomic.StoreInt32(&stub.stallData, 1)
+	pool := NewSMTPPool(PoolConfig{Addr: stub.Addr(), Auth: stubAuth(stub), MaxConns: 1})
+	defer pool.Close()
+
+	busy, cancelBusy := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- pool.Send(busy, "ventas@tienda.com", []string{"a@ejemplo.com"}, poolTestMessage) }()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&stub.connections) == 1 }, time.Second, 10*time.Millisecond)
+
+	// El único slot está ocupado: la espera termina con el contexto
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, pool.Send(ctx, "ventas@tienda.com", []string{"b@ejemplo.com"}, poolTestMessage), context.DeadlineExceeded)
+
+	cancelBusy()
+	require.True(t, errors.Is(<-done, context.Canceled))
+}
+
+func TestGmailSenderSend(t *testing.T) {
+	stub := newSMTPStub(t)
+	sender := NewGmailSender("Tienda", "ventas@tienda.com", "secret", WithServer(stub.Addr()))
+
+	msg, err := NewMessage().To("Cliente <cliente@ejemplo.com>").Subject("Hola").HTML("<p>Hola</p>").Build()
+	require.NoError(t, err)
+	require.NoError(t, sender.Send(context.Background(), msg))
+	require.Len(t, stub.received, 1)
+	require.Contains(t, string(stub.received[0]), "Subject: Hola")
+}
+
+func TestPhaseObserver(t *testing.T) {
+	var mu sync.Mutex
+	var phases []string
+	SetPhaseObserver(func(ctx context.Context, phase SMTPPhase) func(error) {
+		return func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			phases = append(phases, string(phase))
+		}
+	})
+	t.Cleanup(func() { SetPhaseObserver(nil) })
+
+	stub := newSMTPStub(t)
+	transport := &directTransport{addr: stub.Addr(), auth: stubAuth(stub)}
+	require.NoError(t, transport.Send(context.Background(), "ventas@tienda.com", []string{"cliente@ejemplo.com"}, poolTestMessage))
+	require.Equal(t, []string{"dial", "handshake", "send"}, phases)
+
+	// La verificación de /readyz no cuenta como envío
+	verifier := NewGmailSender("Tienda", "ventas@tienda.com", "secret", WithServer(stub.Addr()), WithAuth(stubAuth(stub))).(Verifier)
+	require.NoError(t, verifier.Verify(context.Background()))
+	require.Len(t, phases, 3)
+}
+
+func TestGmailSenderVerify(t *testing.T) {
+	stub := newSMTPStub(t)
+	sender := NewGmailSender("Tienda", "ventas@tienda.com", "secret", WithServer(stub.Addr()))
+	verifier, ok := sender.(Verifier)
+	require.True(t, ok)
+
+	require.NoError(t, verifier.Verify(context.Background()))
+	require.Zero(t, atomic.LoadInt32(&stub.messages))
+
+	atomic.StoreInt32(&stub.rejectAuth, 1)
+	err := verifier.Verify(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "535")
+}
@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+// Servidor SMTP de Microsoft 365 (el de Gmail es el servidor por defecto)
+const Microsoft365Server = "smtp.office365.com:587"
+
+// OAuth2Config contiene las credenciales para obtener access tokens a partir de un refresh token
+type OAuth2Config struct {
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	TokenURL     string
+	Scopes       []string
+}
+
+// Provider reúne el servidor SMTP, el endpoint de token y los scopes de un
+// proveedor, para que no se mezclen el servidor de uno con el token de otro
+type Provider struct {
+	Server   string
+	Host     string
+	TokenURL string
+	Scopes   []string
+}
+
+// ProviderByName devuelve "gmail" (también "google" o vacío) o "microsoft"
+// (también "office365" u "outlook")
+func ProviderByName(name string) (Provider, error) {
+	switch name {
+	case "", "gmail", "google":
+		// El refresh token de Google conserva el scope con que se emitió
+		return Provider{Server: "smtp.gmail.com:587", Host: "smtp.gmail.com", TokenURL: endpoints.Google.TokenURL}, nil
+	case "microsoft", "office365", "outlook":
+		// Sin el scope SMTP.Send el token de Microsoft no sirve para AUTH
+		return Provider{
+			Server:   Microsoft365Server,
+			Host:     "smtp.office365.com",
+			TokenURL: endpoints.AzureAD("common").TokenURL,
+			Scopes:   []string{"https://outlook.office.com/SMTP.Send", "offline_access"},
+		}, nil
+	default:
+		return Provider{}, fmt.Errorf("unknown OAuth2 provider %q", name)
+	}
+}
+
+// TokenURLForProvider devuelve el endpoint de token de "gmail" o "microsoft"
+func TokenURLForProvider(provider string) (string, error) {
+	p, err := ProviderByName(provider)
+	return p.TokenURL, err
+}
+
+// NewRefreshTokenSource crea un TokenSource que renueva el access token con el
+// refresh token y lo guarda en caché hasta que expira
+func NewRefreshTokenSource(ctx context.Context, config OAuth2Config) oauth2.TokenSource {
+	conf := &oauth2.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: config.TokenURL},
+		Scopes:       config.Scopes,
+	}
+	return conf.TokenSource(ctx, &oauth2.Token{RefreshToken: config.RefreshToken})
+}
+
+type xoauth2Auth struct {
+	username string
+	host     string
+	source   oauth2.TokenSource
+}
+
+// XOAuth2Auth devuelve un smtp.Auth que implementa el mecanismo XOAUTH2 de
+// Gmail y Microsoft 365. Igual que smtp.PlainAuth, sólo envía el token sobre
+// TLS o hacia localhost.
+func XOAuth2Auth(username string, source oauth2.TokenSource, host string) smtp.Auth {
+	return &xoauth2Auth{username: username, host: host, source: source}
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, fmt.Errorf("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, fmt.Errorf("wrong host name")
+	}
+
+	token, err := a.source.Token()
+	if err != nil {
+		return "", nil, fmt.Errorf("error obtaining OAuth2 token: %w", err)
+	}
+
+	resp := fmt.Sprintf("user=%s\x01auth=%s %s\x01\x01", a.username, token.Type(), token.AccessToken)
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// El servidor responde con un JSON describiendo el error antes del 535
+		return nil, fmt.Errorf("XOAUTH2 authentication failed: %s", fromServer)
+	}
+	return nil, nil
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
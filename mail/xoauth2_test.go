@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeTokenServer(t *testing.T, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		require.Equal(t, "refresh-123", r.PostForm.Get("refresh_token"))
+
+		atomic.AddInt32(hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access-abc",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+}
+
+func TestXOAuth2AuthUsesCachedToken(t *testing.T) {
+	var hits int32
+	server := newFakeTokenServer(t, &hits)
+	defer server.Close()
+
+	source := NewRefreshTokenSource(context.Background(), OAuth2Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RefreshToken: "refresh-123",
+		TokenURL:     server.URL,
+	})
+	auth := XOAuth2Auth("ventas@tienda.com", source, "smtp.office365.com")
+	info := &smtp.ServerInfo{Name: "smtp.office365.com", TLS: true, Auth: []string{"XOAUTH2"}}
+
+	for i := 0; i < 3; i++ {
+		mech, resp, err := auth.Start(info)
+		require.NoError(t, err)
+		require.Equal(t, "XOAUTH2", mech)
+		require.Equal(t, "user=ventas@tienda.com\x01auth=Bearer access-abc\x01\x01", string(resp))
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestXOAuth2AuthRejectsInsecureConnections(t *testing.T) {
+	var hits int32
+	server := newFakeTokenServer(t, &hits)
+	defer server.Close()
+
+	source := NewRefreshTokenSource(context.Background(), OAuth2Config{RefreshToken: "refresh-123", TokenURL: server.URL})
+
+	_, _, err := XOAuth2Auth("a@b.com", source, "smtp.gmail.com").Start(&smtp.ServerInfo{Name: "smtp.gmail.com"})
+	require.Error(t, err)
+
+	_, _, err = XOAuth2Auth("a@b.com", source, "smtp.gmail.com").Start(&smtp.ServerInfo{Name: "evil.com", TLS: true})
+	require.Error(t, err)
+	require.Equal(t, int32(0), atomic.LoadInt32(&hits))
+}
+
+func TestXOAuth2AuthReportsServerError(t *testing.T) {
+	auth := XOAuth2Auth("a@b.com", nil, "localhost")
+
+	_, err := auth.Next([]byte(`{"status":"401","schemes":"bearer"}`), true)
+	require.ErrorContains(t, err, `"status":"401"`)
+
+	resp, err := auth.Next(nil, false)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+}
+
+func TestTokenURLForProvider(t *testing.T) {
+	url, err := TokenURLForProvider("gmail")
+	require.NoError(t, err)
+	require.Equal(t, "https://oauth2.googleapis.com/token", url)
+
+	url, err = TokenURLForProvider("microsoft")
+	require.NoError(t, err)
+	require.Equal(t, "https://login.microsoftonline.com/common/oauth2/v2.0/token", url)
+
+	_, err = TokenURLForProvider("yahoo")
+	require.Error(t, err)
+}
+
+func TestProviderByName(t *testing.T) {
+	// Los alias de Microsoft usan servidor, token y scopes de Office 365
+	for _, name := range []string{"microsoft", "office365", "outlook"} {
+		p, err := ProviderByName(name)
+		require.NoError(t, err)
+		require.Equal(t, Microsoft365Server, p.Server)
+		require.Equal(t, "smtp.office365.com", p.Host)
+		require.Equal(t, "https://login.microsoftonline.com/common/oauth2/v2.0/token", p.TokenURL)
+		require.Equal(t, []string{"https://outlook.office.com/SMTP.Send", "offline_access"}, p.Scopes)
+	}
+
+	p, err := ProviderByName("")
+	require.NoError(t, err)
+	require.Equal(t, "smtp.gmail.com:587", p.Server)
+	require.Equal(t, "https://oauth2.googleapis.com/token", p.TokenURL)
+
+	_, err = ProviderByName("yahoo")
+	require.Error(t, err)
+}
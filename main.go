@@ -2,30 +2,41 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"html"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
 	"email-api/mail"
 
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func init() {
 	err := godotenv.Load()
+	setupLogging()
 	if err != nil {
-		log.Println("Advertencia: no se cargó el archivo .env, utilizando variables de entorno del sistema.")
+		slog.Warn("no se cargó el archivo .env, utilizando variables de entorno del sistema")
 	}
 }
 
-// Estructura para los productos recomendados
-type Product struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Image       string `json:"image"`
-	BuyURL      string `json:"buy_url"`
+// Tiempo máximo para enviar un correo dentro de una petición HTTP
+const emailSendTimeout = 30 * time.Second
+
+// Código HTTP según el motivo por el que falló el envío
+func sendErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
 }
 
 // Estructura para la solicitud de recomendaciones
@@ -36,6 +47,26 @@ type RecommendationRequest struct {
 	CallToActionURL  string    `json:"call_to_action_url"`
 	PhoneNumber      string    `json:"phone_number"`
 	DestinationEmail string    `json:"destination_email"`
+
+	// to, cc, bcc y reply_to; destination_email se mantiene por compatibilidad
+	RecipientFields
+	Attachments []AttachmentRequest `json:"attachments,omitempty"`
+	// Descargar las imágenes de productos e incrustarlas como partes cid:
+	InlineImages bool `json:"inline_images,omitempty"`
+	// Campos de combinación adicionales para asunto y plantilla
+	Data map[string]any `json:"data,omitempty"`
+	// Idioma del correo, por ejemplo "es" o "es-CL"
+	Locale string `json:"locale,omitempty"`
+	// Tema de marca; si falta se usa DEFAULT_BRAND
+	Brand string `json:"brand,omitempty"`
+}
+
+// Correo del único destinatario, para buscar su contacto
+func (req RecommendationRequest) contactEmail() string {
+	if len(req.To) == 1 {
+		return req.To[0].Email
+	}
+	return req.DestinationEmail
 }
 
 // Estructura para la llamada telefónica
@@ -48,250 +79,84 @@ type EmailRequest struct {
 	Mail    string `json:"mail"`
 	Subject string `json:"subject"`
 	Body    string `json:"body"`
-}
 
-// Habilitar CORS
-func enableCors(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
-	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	// Si no se indica "to" se envía a DESTINATION_EMAIL
+	RecipientFields
+	Attachments []AttachmentRequest `json:"attachments,omitempty"`
 }
 
-// Generar la sección de productos en HTML
-func generateProductsSection(products []Product) string {
-	var productsHTML string
-	for _, product := range products {
-		imageSection := fmt.Sprintf(`<div class="product-image">%s</div>`, product.Image)
-		if product.Image != "" {
-			imageSection = fmt.Sprintf(`<img src="%s" alt="%s" style="width: 100%%; height: 150px; object-fit: cover; border-radius: 6px; margin-bottom: 15px;">`, product.Image, product.Name)
+// Campos disponibles en la plantilla de recomendaciones. Los datos de la
+// petición se agregan primero para que no pisen los campos calculados.
+func recommendationData(req RecommendationRequest, contact *Contact) (map[string]any, error) {
+	data := make(map[string]any, len(req.Data)+8)
+	for key, value := range req.Data {
+		data[key] = value
+	}
+
+	userName := req.UserName
+	contactLocale := ""
+	if contact != nil {
+		contactLocale = contact.Locale
+		fields := map[string]any{
+			"email":      contact.Email,
+			"name":       contact.Name,
+			"first_name": firstName(contact.Name),
+			"locale":     contact.Locale,
+			"timezone":   contact.TimeZone,
+			"phone":      contact.Phone,
+			"tags":       contact.Tags,
+		}
+		for key, value := range contact.Attributes {
+			if _, ok := fields[key]; !ok {
+				fields[key] = value
+			}
+		}
+		data["contact"] = fields
+		if userName == "" {
+			userName = contact.Name
 		}
+	}
+
+	data["user_name"] = userName
+	data["first_name"] = firstName(userName)
+	data["subject"] = req.Subject
+	data["products"] = req.Products
+	data["call_to_action_url"] = req.CallToActionURL
+	data["phone_number"] = req.PhoneNumber
+	data["today"] = time.Now()
+
+	loc := resolveLocale(req.Locale, contactLocale)
+	data["locale"] = loc.Code
+	data["msg"] = loc.Messages
 
-		productsHTML += fmt.Sprintf(`
-			<div class="recommendation-section">
-				<div class="recommendation-card">
-					%s
-					<h3>%s</h3>
-					<p>%s</p>
-					<a href="%s" class="buy-btn">BUY NOW</a>
-				</div>
-			</div>
-		`, imageSection, product.Name, product.Description, product.BuyURL)
-	}
-	return productsHTML
+	theme, err := themes.Resolve(req.Brand)
+	if err != nil {
+		return nil, err
+	}
+	data["theme"] = theme.view(loc)
+	return data, nil
 }
 
 // Generar el HTML completo de recomendaciones
-func generateRecommendationHTML(req RecommendationRequest) string {
-	productsSection := generateProductsSection(req.Products)
-
-	htmlTemplate := `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Product Recommendations</title>
-    <style>
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
-            line-height: 1.6;
-            color: #000;
-            margin: 0;
-            padding: 0;
-            background-color: #f0f0f0;
-        }
-        .container {
-            max-width: 600px;
-            margin: 0 auto;
-            background-color: #ffffff;
-        }
-        .header-banner {
-            background: #000000;
-            padding: 40px 20px;
-            text-align: center;
-            color: white;
-        }
-        .header-banner h1 {
-            margin: 0;
-            font-size: 28px;
-            font-weight: 700;
-        }
-        .content {
-            padding: 40px 20px;
-        }
-        .greeting {
-            font-size: 24px;
-            font-weight: 600;
-            margin-bottom: 20px;
-            color: #000;
-        }
-        .intro-text {
-            font-size: 14px;
-            line-height: 1.8;
-            color: #333;
-            margin-bottom: 30px;
-        }
-        .recommendation-section {
-            margin-bottom: 40px;
-        }
-        .recommendation-card {
-            border: 2px solid #000;
-            border-radius: 8px;
-            padding: 25px;
-            text-align: center;
-            background-color: #fafafa;
-            margin-bottom: 15px;
-        }
-        .recommendation-card h3 {
-            margin: 0 0 15px 0;
-            font-size: 18px;
-            font-weight: 600;
-            color: #000;
-        }
-        .recommendation-card p {
-            margin: 0 0 15px 0;
-            font-size: 13px;
-            color: #333;
-        }
-        .product-image {
-            width: 100%%;
-            height: 150px;
-            background: #cccccc;
-            border-radius: 6px;
-            margin-bottom: 15px;
-            display: flex;
-            align-items: center;
-            justify-content: center;
-            color: #000;
-            font-size: 14px;
-        }
-        .buy-btn {
-            display: inline-block;
-            padding: 12px 30px;
-            background-color: #000;
-            color: white;
-            text-decoration: none;
-            border: 2px solid #000;
-            border-radius: 4px;
-            font-weight: 600;
-            font-size: 14px;
-            cursor: pointer;
-            transition: all 0.3s ease;
-        }
-        .buy-btn:hover {
-            background-color: #333;
-            border-color: #333;
-        }
-        .divider {
-            height: 1px;
-            background-color: #000;
-            margin: 40px 0;
-        }
-        .footer-section {
-            background-color: #f0f0f0;
-            padding: 30px 20px;
-            text-align: center;
-            border-top: 2px solid #000;
-        }
-        .footer-text {
-            font-size: 16px;
-            font-weight: 500;
-            color: #000;
-            margin-bottom: 20px;
-        }
-        .call-btn {
-            display: inline-block;
-            padding: 14px 25px;
-            background-color: #fff;
-            color: #000;
-            text-decoration: none;
-            border: 2px solid #000;
-            border-radius: 4px;
-            font-weight: 600;
-            font-size: 14px;
-            cursor: pointer;
-            transition: all 0.3s ease;
-        }
-        .call-btn:hover {
-            background-color: #000;
-            color: #fff;
-        }
-        .call-icon {
-            margin-right: 8px;
-            font-size: 16px;
-        }
-        .footer-info {
-            font-size: 12px;
-            color: #666;
-            margin-top: 20px;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <!-- Header Banner -->
-        <div class="header-banner">
-            <h1>🎁 Special Offers Just For You</h1>
-        </div>
-
-        <!-- Main Content -->
-        <div class="content">
-            <div class="greeting">Hello, %s</div>
-            
-            <div class="intro-text">
-                We've curated some amazing products we think you'll love. Discover our latest recommendations tailored especially for you. Don't miss out on these exclusive deals and offers available for a limited time only!
-            </div>
-
-            %s
-
-            <div class="divider"></div>
-
-            <!-- Footer Section -->
-            <div class="footer-section">
-                <div class="footer-text">Have questions or need assistance?</div>
-                <a href="http://165.22.175.227:8000/api/v1/phonecalls/make_call_get?phone_number=%s" class="call-btn">
-                    <span class="call-icon">📞</span>Make a call!
-                </a>
-                <div class="footer-info">
-                    <p>We're here to help 24 / 7 !</p>
-                </div>
-            </div>
-        </div>
-    </div>
-</body>
-</html>`
-
-	return fmt.Sprintf(htmlTemplate, req.UserName, productsSection, req.PhoneNumber)
+func generateRecommendationHTML(data map[string]any) (string, error) {
+	return renderTemplate("recommendation.html", data)
 }
 
 // Handler para enviar el correo
 func sendEmailHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("🔵 Recibida petición en /send-email")
-	enableCors(&w) // Habilitar CORS para todas las solicitudes
-
-	// Manejar las solicitudes OPTIONS para CORS
-	if r.Method == "OPTIONS" {
-		log.Println("✅ Respondiendo a OPTIONS request")
-		w.WriteHeader(http.StatusOK)
+	// Decodificar la solicitud (JSON o multipart/form-data) y sus adjuntos
+	emailReq, attachments, err := decodeEmailRequest(w, r, loadAttachmentLimits())
+	if err != nil {
+		slog.WarnContext(r.Context(), "solicitud inválida", "error", err)
+		http.Error(w, err.Error(), attachmentErrorStatus(err))
 		return
 	}
-
-	// Asegurarse de que sea un POST
-	if r.Method != http.MethodPost {
-		log.Printf("❌ Método no permitido: %s", r.Method)
-		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+	if err := emailReq.checkTextLimits(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Decodificar el JSON de la solicitud
-	var emailReq EmailRequest
-	err := json.NewDecoder(r.Body).Decode(&emailReq)
-	if err != nil {
-		log.Printf("❌ Error al decodificar JSON: %v", err)
-		http.Error(w, "Error al procesar el JSON", http.StatusBadRequest)
-		return
-	}
-
-	log.Printf("📧 Procesando email para: %s, Subject: %s", emailReq.Mail, emailReq.Subject)
+	slog.InfoContext(r.Context(), "procesando email", "email", emailReq.Mail, "subject", emailReq.Subject)
 
 	// Construir el contenido del correo
 	content := fmt.Sprintf(`
@@ -306,131 +171,195 @@ func sendEmailHandler(w http.ResponseWriter, r *http.Request) {
 	emailPassword := os.Getenv("EMAIL_SENDER_PASSWORD")
 	destinationEmail := os.Getenv("DESTINATION_EMAIL")
 
-	log.Printf("📋 Config Email - Name: %s, Address: %s, Password: %s, Destination: %s",
-		emailName, emailAddress,
-		func() string {
-			if emailPassword != "" {
-				return "[CONFIGURADO]"
-			} else {
-				return "[NO CONFIGURADO]"
-			}
-		}(),
-		destinationEmail)
+	slog.DebugContext(r.Context(), "configuración de email",
+		"sender", emailAddress,
+		"password_configured", emailPassword != "",
+		"destination", destinationEmail)
+
+	recipients, err := resolveRecipients(emailReq.RecipientFields, destinationEmail, loadMaxRecipients())
+	if err != nil {
+		slog.WarnContext(r.Context(), "destinatarios inválidos", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Si no hay configuración de email, devolver respuesta exitosa sin enviar
-	if emailAddress == "" || emailPassword == "" {
-		log.Println("⚠️ Configuración de email no encontrada, respondiendo sin enviar")
+	if emailAddress == "" || !emailCredentialsConfigured(emailPassword) {
+		slog.WarnContext(r.Context(), "configuración de email no encontrada, respondiendo sin enviar")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Email configurado pero no enviado (falta configuración)"))
 		return
 	}
 
 	// Crear el remitente usando el paquete mail
-	log.Println("📨 Creando sender...")
-	sender := mail.NewGmailSender(emailName, emailAddress, emailPassword)
-
-	// Enviar el correo
-	to := []string{destinationEmail}
-	attachFiles := []string{} // Puedes agregar archivos si es necesario
+	sender := instrumentSender(mail.NewGmailSender(emailName, emailAddress, emailPassword, senderOptions...))
+
+	// Construir el mensaje
+	builder := recipients.Apply(mail.NewMessage()).
+		Subject(emailReq.Subject).
+		HTML(content).
+		Tag("send-email")
+	for _, a := range attachments {
+		builder.Attach(a.Filename, a.ContentType, a.Content)
+	}
+	msg, err := builder.Build()
+	if err != nil {
+		slog.WarnContext(r.Context(), "mensaje inválido", "error", err)
+		http.Error(w, fmt.Sprintf("Mensaje inválido: %v", err), http.StatusBadRequest)
+		return
+	}
 
-	log.Printf("📤 Enviando email a: %v", to)
-	err = sender.SendEmail(emailReq.Subject, content, to, nil, nil, attachFiles)
+	slog.InfoContext(r.Context(), "enviando email", "recipients", recipients.Count())
+	ctx, cancel := context.WithTimeout(r.Context(), emailSendTimeout)
+	defer cancel()
+	err = sender.Send(ctx, msg)
 	if err != nil {
-		log.Printf("❌ Error al enviar email: %v", err)
-		http.Error(w, fmt.Sprintf("Error al enviar el correo: %v", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error al enviar email", "error", err)
+		http.Error(w, fmt.Sprintf("Error al enviar el correo: %v", err), sendErrorStatus(err))
 		return
 	}
 
-	log.Println("✅ Email enviado exitosamente")
+	slog.InfoContext(r.Context(), "email enviado")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Correo enviado exitosamente"))
 }
 
 // Handler para enviar recomendaciones de productos
 func sendRecommendationHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("🔵 Recibida petición en /recommendations")
-	enableCors(&w) // Habilitar CORS para todas las solicitudes
+	// Decodificar el JSON de la solicitud
+	var recommendationReq RecommendationRequest
+	err := json.NewDecoder(r.Body).Decode(&recommendationReq)
+	if err != nil {
+		slog.WarnContext(r.Context(), "error al decodificar JSON", "error", err)
+		http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
+		return
+	}
 
-	// Manejar las solicitudes OPTIONS para CORS
-	if r.Method == "OPTIONS" {
-		log.Println("✅ Respondiendo a OPTIONS request")
-		w.WriteHeader(http.StatusOK)
+	slog.InfoContext(r.Context(), "procesando recomendaciones", "products", len(recommendationReq.Products))
+
+	if err := recommendationReq.checkTextLimits(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Asegurarse de que sea un POST
-	if r.Method != http.MethodPost {
-		log.Printf("❌ Método no permitido: %s", r.Method)
-		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+	recommendationReq.Products, err = normalizeProducts(recommendationReq.Products)
+	if err != nil {
+		slog.WarnContext(r.Context(), "productos inválidos", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Decodificar el JSON de la solicitud
-	var recommendationReq RecommendationRequest
-	err := json.NewDecoder(r.Body).Decode(&recommendationReq)
+	attachments, err := decodeAttachments(recommendationReq.Attachments, loadAttachmentLimits())
 	if err != nil {
-		log.Printf("❌ Error al decodificar JSON: %v", err)
-		http.Error(w, "Error al procesar el JSON", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "adjuntos inválidos", "error", err)
+		http.Error(w, err.Error(), attachmentErrorStatus(err))
 		return
 	}
 
-	log.Printf("🛍️ Procesando recomendaciones para: %s, Productos: %d",
-		recommendationReq.UserName, len(recommendationReq.Products))
+	// Incrustar las imágenes de productos para que no dependan de imágenes remotas
+	var inlineImages []mail.Attachment
+	if recommendationReq.InlineImages || os.Getenv("INLINE_PRODUCT_IMAGES") == "true" {
+		slog.DebugContext(r.Context(), "incrustando imágenes de productos")
+		recommendationReq.Products, inlineImages = embedProductImages(r.Context(), productImageFetcher, recommendationReq.Products)
+	}
 
-	// Generar el HTML de las recomendaciones
-	log.Println("🎨 Generando HTML de recomendaciones...")
-	htmlContent := generateRecommendationHTML(recommendationReq)
-	log.Printf("✅ HTML generado, tamaño: %d caracteres", len(htmlContent))
+	// Generar el HTML de las recomendaciones; el contacto del destinatario
+	// aporta su idioma si el pedido no trae locale
+	var contact *Contact
+	if c, ok := contacts.Get(recommendationReq.contactEmail()); ok {
+		contact = &c
+	}
+	data, err := recommendationData(recommendationReq, contact)
+	if err != nil {
+		slog.WarnContext(r.Context(), "tema inválido", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, span := tracer.Start(r.Context(), "render recommendation.html")
+	htmlContent, err := generateRecommendationHTML(data)
+	if err == nil {
+		htmlContent = prepareEmailHTML(htmlContent)
+	}
+	endSpan(span, err)
+	if err != nil {
+		slog.WarnContext(r.Context(), "error en la plantilla", "error", err)
+		http.Error(w, fmt.Sprintf("Error en la plantilla: %v", err), http.StatusBadRequest)
+		return
+	}
+	lintRendered("recommendation", htmlContent, "")
+	subject, err := renderText("subject", recommendationReq.Subject, data)
+	if err != nil {
+		slog.WarnContext(r.Context(), "error en el asunto", "error", err)
+		http.Error(w, fmt.Sprintf("Error en la plantilla: %v", err), http.StatusBadRequest)
+		return
+	}
+	slog.DebugContext(r.Context(), "HTML generado", "size", len(htmlContent))
 
 	// Verificar configuración de email
 	emailName := os.Getenv("EMAIL_SENDER_NAME")
 	emailAddress := os.Getenv("EMAIL_SENDER_ADDRESS")
 	emailPassword := os.Getenv("EMAIL_SENDER_PASSWORD")
-	
-	log.Printf("📋 Config Email - Name: %s, Address: %s, Password: %s, Destination: %s", 
-		emailName, emailAddress, 
-		func() string { if emailPassword != "" { return "[CONFIGURADO]" } else { return "[NO CONFIGURADO]" } }(),
-		recommendationReq.DestinationEmail)
+
+	slog.DebugContext(r.Context(), "configuración de email",
+		"sender", emailAddress,
+		"password_configured", emailPassword != "",
+		"destination", recommendationReq.DestinationEmail)
+
+	recipients, err := resolveRecipients(recommendationReq.RecipientFields, recommendationReq.DestinationEmail, loadMaxRecipients())
+	if err != nil {
+		slog.WarnContext(r.Context(), "destinatarios inválidos", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Si no hay configuración de email, devolver respuesta exitosa sin enviar
-	if emailAddress == "" || emailPassword == "" {
-		log.Println("⚠️ Configuración de email no encontrada, respondiendo sin enviar")
+	if emailAddress == "" || !emailCredentialsConfigured(emailPassword) {
+		slog.WarnContext(r.Context(), "configuración de email no encontrada, respondiendo sin enviar")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Recomendaciones configuradas pero no enviadas (falta configuración)"))
 		return
 	}
 
 	// Crear el remitente usando el paquete mail
-	log.Println("📨 Creando sender...")
-	sender := mail.NewGmailSender(emailName, emailAddress, emailPassword)
-
-	// Enviar el correo
-	to := []string{recommendationReq.DestinationEmail}
-	attachFiles := []string{} // Puedes agregar archivos si es necesario
+	sender := instrumentSender(mail.NewGmailSender(emailName, emailAddress, emailPassword, senderOptions...))
+
+	// Construir el mensaje
+	builder := recipients.Apply(mail.NewMessage()).
+		Subject(subject).
+		HTML(htmlContent).
+		Tag("recommendation")
+	for _, a := range attachments {
+		builder.Attach(a.Filename, a.ContentType, a.Content)
+	}
+	for _, img := range inlineImages {
+		builder.Inline(img.ContentID, img.Filename, img.ContentType, img.Content)
+	}
+	msg, err := builder.Build()
+	if err != nil {
+		slog.WarnContext(r.Context(), "mensaje inválido", "error", err)
+		http.Error(w, fmt.Sprintf("Mensaje inválido: %v", err), http.StatusBadRequest)
+		return
+	}
 
-	log.Printf("📤 Enviando email de recomendaciones a: %v", to)
-	err = sender.SendEmail(recommendationReq.Subject, htmlContent, to, nil, nil, attachFiles)
+	slog.InfoContext(r.Context(), "enviando email de recomendaciones", "recipients", recipients.Count())
+	ctx, cancel := context.WithTimeout(r.Context(), emailSendTimeout)
+	defer cancel()
+	err = sender.Send(ctx, msg)
 	if err != nil {
-		log.Printf("❌ Error al enviar email de recomendaciones: %v", err)
-		http.Error(w, fmt.Sprintf("Error al enviar el correo: %v", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error al enviar email de recomendaciones", "error", err)
+		http.Error(w, fmt.Sprintf("Error al enviar el correo: %v", err), sendErrorStatus(err))
 		return
 	}
 
-	log.Println("✅ Email de recomendaciones enviado exitosamente")
+	slog.InfoContext(r.Context(), "email de recomendaciones enviado")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Correo de recomendaciones enviado exitosamente"))
 }
 
 // Handler para manejar las llamadas del botón "Make a call"
 func callActionHandler(w http.ResponseWriter, r *http.Request) {
-	enableCors(&w)
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	var phoneNumber string
+	callActionRequests.WithLabelValues(r.Method).Inc()
 
 	if r.Method == http.MethodGet {
 		// Obtener el número de teléfono desde los parámetros de la URL
@@ -439,49 +368,41 @@ func callActionHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Número de teléfono requerido", http.StatusBadRequest)
 			return
 		}
-	} else if r.Method == http.MethodPost {
+	} else {
 		// Decodificar la solicitud JSON para obtener el número de teléfono
 		var callReq PhoneCallRequest
 		err := json.NewDecoder(r.Body).Decode(&callReq)
 		if err != nil {
-			http.Error(w, "Error al procesar el JSON", http.StatusBadRequest)
+			http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
 			return
 		}
 		phoneNumber = callReq.PhoneNumber
-	} else {
-		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
-		return
 	}
 
-	log.Printf("Usuario solicitó llamada para el número: %s", phoneNumber)
+	slog.InfoContext(r.Context(), "usuario solicitó llamada", "phone", phoneNumber)
 
 	// Hacer la llamada a la API externa
-	err := makePhoneCall(phoneNumber)
+	err := makePhoneCall(r.Context(), phoneNumber)
 	if err != nil {
-		log.Printf("Error al hacer la llamada: %v", err)
+		slog.ErrorContext(r.Context(), "error al hacer la llamada", "phone", phoneNumber, "error", err)
 
 		// Responder con HTML para mejor experiencia de usuario desde el email
-		w.Header().Set("Content-Type", "text/html")
-		w.WriteHeader(http.StatusInternalServerError)
-		html := fmt.Sprintf(`
+		page := fmt.Sprintf(`
 			<html>
 			<head><title>Error en la llamada</title></head>
 			<body style="font-family: Arial, sans-serif; text-align: center; padding: 50px;">
 				<h2>❌ Error al procesar la llamada</h2>
 				<p>Lo sentimos, ocurrió un error al intentar realizar la llamada al número %s.</p>
-				<p>Error: %v</p>
-				<a href="javascript:history.back()" style="color: #007bff;">← Volver</a>
+				<p>Error: %s</p>
 			</body>
 			</html>
-		`, phoneNumber, err)
-		w.Write([]byte(html))
+		`, html.EscapeString(phoneNumber), html.EscapeString(err.Error()))
+		writeCallPage(w, http.StatusInternalServerError, page)
 		return
 	}
 
 	// Responder con HTML para mejor experiencia de usuario desde el email
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	html := fmt.Sprintf(`
+	page := fmt.Sprintf(`
 		<html>
 		<head><title>Llamada iniciada</title></head>
 		<body style="font-family: Arial, sans-serif; text-align: center; padding: 50px;">
@@ -490,12 +411,33 @@ func callActionHandler(w http.ResponseWriter, r *http.Request) {
 			<p>Gracias por usar nuestro servicio.</p>
 		</body>
 		</html>
-	`, phoneNumber)
-	w.Write([]byte(html))
+	`, html.EscapeString(phoneNumber))
+	writeCallPage(w, http.StatusOK, page)
+}
+
+// Página de /call-action con encabezados de seguridad. El número viene de la
+// URL, así que la política no permite scripts, recursos externos ni iframes.
+func writeCallPage(w http.ResponseWriter, status int, page string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write([]byte(page))
 }
 
+// API externa que inicia las llamadas
+var phoneCallAPIURL = "http://165.22.175.227:8000/api/v1/phonecalls/make_call_body"
+
 // Función para hacer la llamada a la API externa
-func makePhoneCall(phoneNumber string) error {
+func makePhoneCall(ctx context.Context, phoneNumber string) (err error) {
+	ctx, span := tracer.Start(ctx, "POST phone API",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(http.MethodPost)))
+	defer func() { endSpan(span, err) }()
+
 	// Preparar el payload para la API externa
 	payload := PhoneCallRequest{
 		PhoneNumber: phoneNumber,
@@ -503,42 +445,44 @@ func makePhoneCall(phoneNumber string) error {
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
+		callAPIFailures.WithLabelValues("encode").Inc()
 		return fmt.Errorf("error al codificar JSON: %v", err)
 	}
 
-	// Hacer la petición POST a la API externa
-	resp, err := http.Post(
-		"http://165.22.175.227:8000/api/v1/phonecalls/make_call_body",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	// Hacer la petición POST a la API externa con el mismo X-Request-ID
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, phoneCallAPIURL, bytes.NewBuffer(jsonData))
 	if err != nil {
+		callAPIFailures.WithLabelValues("request").Inc()
+		return fmt.Errorf("error al crear la petición HTTP: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := mail.RequestIDFrom(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	tracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		callAPIFailures.WithLabelValues("network").Inc()
 		return fmt.Errorf("error al hacer petición HTTP: %v", err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
+		callAPIFailures.WithLabelValues("bad_status").Inc()
 		return fmt.Errorf("API externa respondió con código: %d", resp.StatusCode)
 	}
 
-	log.Printf("Llamada iniciada exitosamente para el número: %s", phoneNumber)
+	slog.InfoContext(ctx, "llamada iniciada", "phone", phoneNumber)
 	return nil
 }
 
 // Health check endpoint
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("🔵 Health check request")
-	enableCors(&w)
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	response := map[string]string{
 		"status":  "ok",
 		"service": "email-api",
-		"version": "1.0.0",
+		"version": buildVersion(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -547,31 +491,84 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	// Health check endpoint
-	http.HandleFunc("/health", healthCheckHandler)
-	http.HandleFunc("/", healthCheckHandler) // Root también responde con health check
+	// Temas de marca para las plantillas
+	themesDir := os.Getenv("THEMES_DIR")
+	if themesDir == "" {
+		themesDir = "themes"
+	}
+	var err error
+	themes, err = newThemeStore(themesDir)
+	if err != nil {
+		fatal("error al cargar los temas", err)
+	}
 
-	// Endpoint original para compatibilidad
-	http.HandleFunc("/send-email", sendEmailHandler)
+	// email-api lint [plantilla|archivo.html ...] revisa las plantillas y termina
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(runLintCommand(os.Args[2:], os.Stdout))
+	}
 
-	// Nuevo endpoint para recomendaciones de productos
-	http.HandleFunc("/recommendations", sendRecommendationHandler)
+	// Trazas de OpenTelemetry y métricas de cada etapa SMTP
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		fatal("error al configurar las trazas", err)
+	}
+	mail.SetPhaseObserver(observeSMTPPhase)
 
-	// Endpoint para manejar las acciones del botón "Make a call"
-	http.HandleFunc("/call-action", callActionHandler)
+	productImageFetcher = newImageFetcherFromEnv()
 
-	fmt.Println("🚀 Servidor escuchando en 0.0.0.0:8080...")
-	fmt.Println("📋 Endpoints disponibles:")
-	fmt.Println("  GET  /health - Health check")
-	fmt.Println("  GET  / - Health check")
-	fmt.Println("  POST /send-email - Envío de correo básico")
-	fmt.Println("  POST /recommendations - Envío de recomendaciones de productos")
-	fmt.Println("  GET|POST /call-action - Manejo de acciones de llamada")
-	fmt.Println("⚠️  Asegúrate de configurar las variables de entorno en .env")
+	smtpOptions, err := loadSMTPOptions()
+	if err != nil {
+		fatal("error al configurar la conexión SMTP", err)
+	}
+	senderOptions = append(senderOptions, smtpOptions...)
 
-	// Mostrar configuración actual
-	emailConfigured := os.Getenv("EMAIL_SENDER_ADDRESS") != ""
-	fmt.Printf("📧 Email configurado: %t\n", emailConfigured)
+	// Firma DKIM opcional para enviar desde dominio propio
+	if dkimKeys := os.Getenv("DKIM_KEYS"); dkimKeys != "" {
+		signer, err := loadDKIMSigner(dkimKeys)
+		if err != nil {
+			fatal("error al cargar claves DKIM", err)
+		}
+		senderOptions = append(senderOptions, mail.WithDKIM(signer))
+	}
+	// senderOptions queda fijo desde aquí: los workers de la cola lo leen
+	// apenas arrancan con los mensajes recuperados
 
-	log.Fatal(http.ListenAndServe("0.0.0.0:8080", nil))
+	contactsPath := os.Getenv("CONTACTS_STORE_PATH")
+	if contactsPath == "" {
+		contactsPath = "data/contacts.json"
+	}
+	contacts, err = newContactStore(contactsPath)
+	if err != nil {
+		fatal("error al cargar los contactos", err)
+	}
+
+	// Cola de envíos en lote con QUEUE_WORKERS workers
+	queue, err = newSendQueueFromEnv()
+	if err != nil {
+		fatal("error al abrir la cola de envíos", err)
+	}
+	queue.Start(context.Background(), int(envInt64("QUEUE_WORKERS", 2)))
+
+	invitesPath := os.Getenv("INVITES_STORE_PATH")
+	if invitesPath == "" {
+		invitesPath = "data/invites.json"
+	}
+	invites, err = newInviteStore(invitesPath)
+	if err != nil {
+		fatal("error al cargar las invitaciones", err)
+	}
+
+	// Sondas de Kubernetes: proceso vivo y dependencias disponibles
+	readinessChecks = newReadinessChecks()
+
+	// Rutas en routes.go, documentadas en el README
+	slog.Info("servidor escuchando",
+		"addr", "0.0.0.0:8080",
+		"email_configured", os.Getenv("EMAIL_SENDER_ADDRESS") != "",
+		"dkim_configured", os.Getenv("DKIM_KEYS") != "")
+
+	server := newHTTPServer("0.0.0.0:8080", withRequestID(withTracing(instrumentHTTP(withCORS(newRouter())))))
+	if err := runServer(server, shutdownTracing); err != nil {
+		fatal("el servidor se detuvo", err)
+	}
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"email-api/mail"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registro propio para no depender del registro global de Prometheus
+var metricsRegistry = prometheus.NewRegistry()
+
+var metricsFactory = promauto.With(metricsRegistry)
+
+var (
+	httpRequests = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_api_http_requests_total",
+		Help: "Peticiones HTTP por ruta, método y código de respuesta.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "email_api_http_request_duration_seconds",
+		Help:    "Duración de las peticiones HTTP por ruta.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	emailsSent = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_api_emails_sent_total",
+		Help: "Correos enviados por plantilla.",
+	}, []string{"template"})
+
+	emailsFailed = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_api_emails_failed_total",
+		Help: "Correos que fallaron por plantilla y clase de error.",
+	}, []string{"template", "error_class"})
+
+	smtpPhaseDuration = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "email_api_smtp_phase_duration_seconds",
+		Help:    "Duración de cada etapa SMTP: dial, handshake (EHLO, STARTTLS, AUTH) y send.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"phase", "result"})
+
+	callActionRequests = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_api_call_action_requests_total",
+		Help: "Peticiones al botón de llamada por método.",
+	}, []string{"method"})
+
+	callAPIFailures = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_api_call_api_failures_total",
+		Help: "Fallas de la API externa de llamadas por motivo.",
+	}, []string{"reason"})
+
+	rateLimitRejections = metricsFactory.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_api_rate_limit_rejections_total",
+		Help: "Rechazos por límite de envío: smtp (el servidor limitó el envío) o http (respuestas 429, reservado: la API todavía no limita peticiones).",
+	}, []string{"source"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "email_api_queue_depth",
+			Help: "Mensajes en la cola sin entregar, incluidos los que esperan un reintento.",
+		}, func() float64 {
+			if queue == nil {
+				return 0
+			}
+			depth, _ := queue.Stats()
+			return float64(depth)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "email_api_queue_oldest_age_seconds",
+			Help: "Antigüedad del mensaje más viejo de la cola.",
+		}, func() float64 {
+			if queue == nil {
+				return 0
+			}
+			_, oldest := queue.Stats()
+			return oldest.Seconds()
+		}),
+	)
+}
+
+// Duración de una etapa SMTP; se registra con observeSMTPPhase
+func recordSMTPPhase(ctx context.Context, phase mail.SMTPPhase) func(error) {
+	start := time.Now()
+	return func(err error) {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		smtpPhaseDuration.WithLabelValues(string(phase), result).Observe(time.Since(start).Seconds())
+	}
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// Registra cada petición con el patrón de la ruta que la atendió, nunca con
+// la ruta completa, que puede traer direcciones (/contacts/{email})
+func instrumentHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+
+		route := routeOf(r)
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+		// Reservado: ningún handler responde 429 todavía, pero el contador
+		// queda listo para cuando la API limite peticiones
+		if rec.status == http.StatusTooManyRequests {
+			rateLimitRejections.WithLabelValues("http").Inc()
+		}
+	})
+}
+
+// Clase de error de un envío para las métricas
+func sendErrorClass(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		switch {
+		case smtpRateLimited(smtpErr):
+			return "rate_limited"
+		case smtpErr.Code == 530 || smtpErr.Code == 534 || smtpErr.Code == 535:
+			return "auth"
+		case smtpErr.Code >= 500:
+			return "rejected"
+		default:
+			return "temporary"
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return "network"
+	}
+	return "other"
+}
+
+// 421 y 454 son "intente más tarde"; Gmail usa 4.7.0 y 5.4.5 cuando se supera
+// la cuota de envío
+func smtpRateLimited(err *textproto.Error) bool {
+	if err.Code == 421 || err.Code == 454 {
+		return true
+	}
+	return strings.HasPrefix(err.Msg, "4.7.0") || strings.HasPrefix(err.Msg, "5.4.5")
+}
+
+// EmailSender que cuenta los envíos y fallas. La plantilla es la primera
+// etiqueta del mensaje ("recommendation", "send", "contact-form", ...).
+type meteredSender struct {
+	mail.EmailSender
+}
+
+// Remitente con métricas y trazas de cada envío
+func instrumentSender(sender mail.EmailSender) mail.EmailSender {
+	return meteredSender{tracedSender{sender}}
+}
+
+func (s meteredSender) Send(ctx context.Context, msg mail.Message) error {
+	template := "other"
+	if len(msg.Tags) > 0 {
+		template = msg.Tags[0]
+	}
+	err := s.EmailSender.Send(ctx, msg)
+	if err != nil {
+		class := sendErrorClass(err)
+		emailsFailed.WithLabelValues(template, class).Inc()
+		if class == "rate_limited" {
+			rateLimitRejections.WithLabelValues("smtp").Inc()
+		}
+		return err
+	}
+	emailsSent.WithLabelValues(template).Inc()
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"email-api/mail"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type stubSender struct {
+	mail.EmailSender
+	err error
+}
+
+func (s stubSender) Send(ctx context.Context, msg mail.Message) error {
+	return s.err
+}
+
+func TestSendErrorClass(t *testing.T) {
+	cases := map[string]error{
+		"timeout":      fmt.Errorf("envío: %w", context.DeadlineExceeded),
+		"canceled":     context.Canceled,
+		"rate_limited": &textproto.Error{Code: 550, Msg: "5.4.5 Daily user sending limit exceeded"},
+		"auth":         &textproto.Error{Code: 535, Msg: "5.7.8 Username and Password not accepted"},
+		"rejected":     &textproto.Error{Code: 550, Msg: "5.1.1 The email account does not exist"},
+		"temporary":    &textproto.Error{Code: 451, Msg: "4.3.0 Temporary server error"},
+		"network":      &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+		"other":        errors.New("plantilla inválida"),
+	}
+	for class, err := range cases {
+		require.Equal(t, class, sendErrorClass(err), err.Error())
+	}
+	require.Equal(t, "rate_limited", sendErrorClass(&textproto.Error{Code: 421, Msg: "4.7.0 Try again later"}))
+}
+
+func TestMeteredSender(t *testing.T) {
+	msg, err := mail.NewMessage().To("a@ejemplo.com").Subject("Hola").Text("Hola").Tag("contact-form").Build()
+	require.NoError(t, err)
+
+	sent := testutil.ToFloat64(emailsSent.WithLabelValues("contact-form"))
+	require.NoError(t, instrumentSender(stubSender{}).Send(context.Background(), msg))
+	require.Equal(t, sent+1, testutil.ToFloat64(emailsSent.WithLabelValues("contact-form")))
+
+	failed := testutil.ToFloat64(emailsFailed.WithLabelValues("contact-form", "rate_limited"))
+	rejected := testutil.ToFloat64(rateLimitRejections.WithLabelValues("smtp"))
+	limit := &textproto.Error{Code: 421, Msg: "4.7.0 Try again later"}
+	require.ErrorIs(t, instrumentSender(stubSender{err: limit}).Send(context.Background(), msg), limit)
+	require.Equal(t, failed+1, testutil.ToFloat64(emailsFailed.WithLabelValues("contact-form", "rate_limited")))
+	require.Equal(t, rejected+1, testutil.ToFloat64(rateLimitRejections.WithLabelValues("smtp")))
+}
+
+func TestCallActionMetrics(t *testing.T) {
+	saved := phoneCallAPIURL
+	t.Cleanup(func() { phoneCallAPIURL = saved })
+	phoneCallAPIURL = "://sin-esquema"
+
+	requests := testutil.ToFloat64(callActionRequests.WithLabelValues(http.MethodGet))
+	failures := testutil.ToFloat64(callAPIFailures.WithLabelValues("request"))
+	rec := httptest.NewRecorder()
+	callActionHandler(rec, httptest.NewRequest(http.MethodGet, "/call-action?phone=%2B56912345678", nil))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Equal(t, requests+1, testutil.ToFloat64(callActionRequests.WithLabelValues(http.MethodGet)))
+	require.Equal(t, failures+1, testutil.ToFloat64(callAPIFailures.WithLabelValues("request")))
+
+	// Las peticiones inválidas también se cuentan
+	callActionHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/call-action", nil))
+	require.Equal(t, requests+2, testutil.ToFloat64(callActionRequests.WithLabelValues(http.MethodGet)))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/contacts/{email}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.Handle("/metrics", metricsHandler())
+	handler := instrumentHTTP(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/contacts/ana@ejemplo.com", nil))
+	require.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("/contacts/{email}", "GET", "429")))
+	require.GreaterOrEqual(t, testutil.ToFloat64(rateLimitRejections.WithLabelValues("http")), 1.0)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	for _, name := range []string{
+		"email_api_http_requests_total",
+		"email_api_http_request_duration_seconds",
+		"email_api_queue_depth",
+		"email_api_queue_oldest_age_seconds",
+		"email_api_rate_limit_rejections_total",
+		"go_goroutines",
+	} {
+		require.Contains(t, body, name)
+	}
+	// La ruta se registra con el patrón, sin la dirección
+	require.NotContains(t, body, "ana@ejemplo.com")
+}
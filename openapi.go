@@ -0,0 +1,29 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// Especificación OpenAPI 3 de la API. openapi_test.go la compara con las
+// rutas y los tipos de petición y respuesta.
+//
+//go:embed openapi/openapi.json
+var openAPISpec []byte
+
+// Página de documentación que muestra la especificación, sin recursos externos
+//
+//go:embed openapi/docs.html
+var docsPage []byte
+
+// GET /openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// GET /docs
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
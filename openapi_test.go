@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Lo necesario de la especificación para compararla con el código
+type openAPIDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*openAPISchema `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref"`
+	Type                 string                    `json:"type"`
+	Format               string                    `json:"format"`
+	Enum                 []string                  `json:"enum"`
+	Properties           map[string]*openAPISchema `json:"properties"`
+	Items                *openAPISchema            `json:"items"`
+	AdditionalProperties json.RawMessage           `json:"additionalProperties"`
+	AllOf                []*openAPISchema          `json:"allOf"`
+	OneOf                []*openAPISchema          `json:"oneOf"`
+	Example              json.RawMessage           `json:"example"`
+}
+
+// Esquemas que describen un tipo de Go. Los que no están aquí (Error,
+// Liveness, Health, ImportResult y los enums) se responden con mapas o texto.
+var openAPITypes = map[string]reflect.Type{
+	"Recipient":                  reflect.TypeFor[Recipient](),
+	"RecipientFields":            reflect.TypeFor[RecipientFields](),
+	"AttachmentRequest":          reflect.TypeFor[AttachmentRequest](),
+	"EmailRequest":               reflect.TypeFor[EmailRequest](),
+	"SendRequest":                reflect.TypeFor[SendRequest](),
+	"SendResponse":               reflect.TypeFor[SendResponse](),
+	"ContactFormRequest":         reflect.TypeFor[ContactFormRequest](),
+	"Product":                    reflect.TypeFor[Product](),
+	"RecommendationRequest":      reflect.TypeFor[RecommendationRequest](),
+	"ContactFilter":              reflect.TypeFor[ContactFilter](),
+	"BatchRecommendationRequest": reflect.TypeFor[BatchRecommendationRequest](),
+	"BatchResponse":              reflect.TypeFor[BatchResponse](),
+	"Contact":                    reflect.TypeFor[Contact](),
+	"ThemeColors":                reflect.TypeFor[ThemeColors](),
+	"SocialLink":                 reflect.TypeFor[SocialLink](),
+	"Theme":                      reflect.TypeFor[Theme](),
+	"LintIssue":                  reflect.TypeFor[LintIssue](),
+	"LintReport":                 reflect.TypeFor[LintReport](),
+	"PhoneCallRequest":           reflect.TypeFor[PhoneCallRequest](),
+	"CalendarInviteRequest":      reflect.TypeFor[CalendarInviteRequest](),
+	"CalendarInviteResponse":     reflect.TypeFor[CalendarInviteResponse](),
+	"CheckResult":                reflect.TypeFor[CheckResult](),
+	"ReadinessResponse":          reflect.TypeFor[ReadinessResponse](),
+}
+
+func loadOpenAPI(t *testing.T) openAPIDocument {
+	t.Helper()
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+	return doc
+}
+
+func (doc openAPIDocument) resolve(s *openAPISchema) (string, *openAPISchema) {
+	if s.Ref == "" {
+		return "", s
+	}
+	name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	return name, doc.Components.Schemas[name]
+}
+
+// Campos JSON de un struct, con los structs embebidos aplanados
+func jsonFields(typ reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && tag == "" {
+			for name, ft := range jsonFields(field.Type) {
+				fields[name] = ft
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// Propiedades del objeto, incluidas las de allOf
+func (doc openAPIDocument) properties(s *openAPISchema) map[string]*openAPISchema {
+	props := map[string]*openAPISchema{}
+	for _, part := range s.AllOf {
+		_, part = doc.resolve(part)
+		for name, prop := range doc.properties(part) {
+			props[name] = prop
+		}
+	}
+	for name, prop := range s.Properties {
+		props[name] = prop
+	}
+	return props
+}
+
+// Compara el esquema con el tipo de Go. Las referencias a otros esquemas de
+// openAPITypes solo se comparan por nombre; cada uno se revisa por separado.
+func (doc openAPIDocument) checkType(t *testing.T, path string, s *openAPISchema, typ reflect.Type) {
+	t.Helper()
+	require.NotNil(t, s, path)
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if name, resolved := doc.resolve(s); name != "" {
+		require.NotNil(t, resolved, "%s: esquema %s no definido", path, name)
+		if want, ok := openAPITypes[name]; ok {
+			require.Equal(t, want, typ, "%s: $ref a %s", path, name)
+			return
+		}
+		s = resolved
+	}
+	// Recipient acepta también un string; se compara la forma de objeto
+	for _, variant := range s.OneOf {
+		if variant.Type == "object" {
+			s = variant
+		}
+	}
+
+	switch {
+	case typ == reflect.TypeFor[time.Time]():
+		require.Equal(t, "string", s.Type, path)
+		require.Equal(t, "date-time", s.Format, path)
+	case typ.Kind() == reflect.String:
+		require.Equal(t, "string", s.Type, path)
+	case typ.Kind() == reflect.Bool:
+		require.Equal(t, "boolean", s.Type, path)
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		require.Equal(t, "integer", s.Type, path)
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		require.Equal(t, "number", s.Type, path)
+	case typ.Kind() == reflect.Slice:
+		require.Equal(t, "array", s.Type, path)
+		doc.checkType(t, path+"[]", s.Items, typ.Elem())
+	case typ.Kind() == reflect.Map:
+		require.Equal(t, "object", s.Type, path)
+		if typ.Elem().Kind() == reflect.Interface {
+			require.JSONEq(t, "true", string(s.AdditionalProperties), path)
+			return
+		}
+		var values openAPISchema
+		require.NoError(t, json.Unmarshal(s.AdditionalProperties, &values), path)
+		doc.checkType(t, path+"{}", &values, typ.Elem())
+	case typ.Kind() == reflect.Struct:
+		fields := jsonFields(typ)
+		props := doc.properties(s)
+		names := func(m any) []string {
+			var keys []string
+			for _, key := range reflect.ValueOf(m).MapKeys() {
+				keys = append(keys, key.String())
+			}
+			slices.Sort(keys)
+			return keys
+		}
+		require.Equal(t, names(fields), names(props), "%s: campos de %s", path, typ)
+		for name, ft := range fields {
+			doc.checkType(t, path+"."+name, props[name], ft)
+		}
+	default:
+		t.Fatalf("%s: tipo %s sin equivalente en OpenAPI", path, typ)
+	}
+}
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	for name, typ := range openAPITypes {
+		t.Run(name, func(t *testing.T) {
+			schema := doc.Components.Schemas[name]
+			require.NotNil(t, schema, "falta el esquema %s", name)
+			doc.checkType(t, name, schema, typ)
+		})
+	}
+}
+
+func TestOpenAPIEnums(t *testing.T) {
+	doc := loadOpenAPI(t)
+	schemas := doc.Components.Schemas
+
+	require.ElementsMatch(t, []SubscriptionStatus{StatusSubscribed, StatusUnsubscribed, StatusBounced}, enumOf[SubscriptionStatus](schemas["SubscriptionStatus"]))
+	require.ElementsMatch(t, []StockStatus{StockInStock, StockLow, StockOutOfStock, StockPreorder}, enumOf[StockStatus](schemas["StockStatus"]))
+	require.ElementsMatch(t, []LintSeverity{LintError, LintWarning}, enumOf[LintSeverity](schemas["LintIssue"].Properties["severity"]))
+}
+
+func enumOf[T ~string](s *openAPISchema) []T {
+	var values []T
+	for _, value := range s.Enum {
+		values = append(values, T(value))
+	}
+	return values
+}
+
+// Los ejemplos de la especificación y los del repositorio deben decodificarse
+// en los tipos sin campos desconocidos
+func TestOpenAPIExamples(t *testing.T) {
+	decodeStrict := func(t *testing.T, data []byte, typ reflect.Type) {
+		t.Helper()
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		require.NoError(t, decoder.Decode(reflect.New(typ).Interface()))
+	}
+
+	doc := loadOpenAPI(t)
+	for name, schema := range doc.Components.Schemas {
+		if len(schema.Example) == 0 || schema.Type == "string" {
+			continue
+		}
+		typ, ok := openAPITypes[name]
+		require.True(t, ok, "el ejemplo de %s no tiene tipo de Go", name)
+		t.Run(name, func(t *testing.T) { decodeStrict(t, schema.Example, typ) })
+	}
+
+	for _, file := range []string{"example-recommendation-request.json", "example-full-recommendation.json"} {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			decodeStrict(t, data, reflect.TypeFor[RecommendationRequest]())
+		})
+	}
+}
+
+// Cada ruta del router está documentada y cada operación documentada existe
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	for _, route := range apiRoutes {
+		path := apiPrefix + route.path
+		require.Contains(t, doc.Paths[path], strings.ToLower(route.method), "%s %s sin documentar", route.method, path)
+	}
+
+	mux := newRouter()
+	wildcard := regexp.MustCompile(`\{[^}]+\}`)
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			method = strings.ToUpper(method)
+			req := httptest.NewRequest(method, wildcard.ReplaceAllString(path, "x"), nil)
+			_, pattern := mux.Handler(req)
+			require.Equal(t, method+" "+path, pattern, "%s %s no está en el router", method, path)
+		}
+	}
+}
+
+func TestOpenAPIHandlers(t *testing.T) {
+	handler := newRouter()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	require.Equal(t, "3.0.3", doc["openapi"])
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, rec.Body.String(), `fetch("/openapi.json")`)
+}
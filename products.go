@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Disponibilidad de un producto
+type StockStatus string
+
+const (
+	StockInStock    StockStatus = "in_stock"
+	StockLow        StockStatus = "low_stock"
+	StockOutOfStock StockStatus = "out_of_stock"
+	StockPreorder   StockStatus = "preorder"
+)
+
+// Estructura para los productos recomendados
+type Product struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	BuyURL      string `json:"buy_url"`
+
+	// Los campos opcionales solo se muestran en la tarjeta si vienen informados
+	Price         float64     `json:"price,omitempty"`
+	OriginalPrice float64     `json:"original_price,omitempty"`
+	Currency      string      `json:"currency,omitempty"`
+	Rating        float64     `json:"rating,omitempty"`
+	Stock         StockStatus `json:"stock,omitempty"`
+	Badges        []string    `json:"badges,omitempty"`
+	SKU           string      `json:"sku,omitempty"`
+}
+
+// Moneda de los productos que no la indican
+func defaultCurrency() string {
+	if currency := os.Getenv("DEFAULT_CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "USD"
+}
+
+func (p Product) HasDiscount() bool {
+	return p.Price > 0 && p.OriginalPrice > p.Price
+}
+
+// Porcentaje de descuento redondeado para la etiqueta "-20%"
+func (p Product) DiscountPercent() int {
+	if !p.HasDiscount() {
+		return 0
+	}
+	return int(math.Round((p.OriginalPrice - p.Price) / p.OriginalPrice * 100))
+}
+
+// Valoración en estrellas redondeada a la estrella más cercana
+func (p Product) Stars() string {
+	full := int(math.Round(p.Rating))
+	return strings.Repeat("★", full) + strings.Repeat("☆", 5-full)
+}
+
+func (p Product) validate() error {
+	switch {
+	case p.Price < 0 || p.OriginalPrice < 0:
+		return fmt.Errorf("producto %q: el precio no puede ser negativo", p.Name)
+	case p.Rating < 0 || p.Rating > 5:
+		return fmt.Errorf("producto %q: rating debe estar entre 0 y 5", p.Name)
+	case p.Currency != "" && len(p.Currency) != 3:
+		return fmt.Errorf("producto %q: currency debe ser un código ISO 4217", p.Name)
+	}
+	limits := []textLimit{
+		{"name", p.Name, maxShortText},
+		{"description", p.Description, maxLongText},
+		{"image", p.Image, maxURLLength},
+		{"buy_url", p.BuyURL, maxURLLength},
+		{"sku", p.SKU, maxShortText},
+	}
+	for _, badge := range p.Badges {
+		limits = append(limits, textLimit{"badges", badge, maxShortText})
+	}
+	if err := checkTextLimits(limits...); err != nil {
+		return fmt.Errorf("producto %.40q: %w", p.Name, err)
+	}
+	switch p.Stock {
+	case "", StockInStock, StockLow, StockOutOfStock, StockPreorder:
+	default:
+		return fmt.Errorf("producto %q: stock desconocido %q", p.Name, p.Stock)
+	}
+	return nil
+}
+
+// Validar los productos y completar la moneda por defecto
+func normalizeProducts(products []Product) ([]Product, error) {
+	if max := maxProducts(); len(products) > max {
+		return nil, fmt.Errorf("se permiten como máximo %d productos", max)
+	}
+	normalized := make([]Product, len(products))
+	for i, p := range products {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if p.Currency == "" {
+			p.Currency = defaultCurrency()
+		}
+		p.Currency = strings.ToUpper(p.Currency)
+		normalized[i] = p
+	}
+	return normalized, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductComputedFields(t *testing.T) {
+	p := Product{Price: 39990, OriginalPrice: 49990, Rating: 4.4}
+	require.True(t, p.HasDiscount())
+	require.Equal(t, 20, p.DiscountPercent())
+	require.Equal(t, "★★★★☆", p.Stars())
+
+	require.False(t, Product{Price: 100, OriginalPrice: 90}.HasDiscount())
+	require.Equal(t, 0, Product{OriginalPrice: 90}.DiscountPercent())
+}
+
+func TestNormalizeProducts(t *testing.T) {
+	t.Setenv("DEFAULT_CURRENCY", "clp")
+	products, err := normalizeProducts([]Product{{Name: "A", Price: 10}, {Name: "B", Currency: "usd"}})
+	require.NoError(t, err)
+	require.Equal(t, "CLP", products[0].Currency)
+	require.Equal(t, "USD", products[1].Currency)
+
+	for _, invalid := range []Product{
+		{Name: "precio", Price: -1},
+		{Name: "rating", Rating: 6},
+		{Name: "stock", Stock: "quizás"},
+		{Name: "moneda", Currency: "pesos"},
+		{Name: "descripción", Description: strings.Repeat("a", maxLongText+1)},
+		{Name: "url", BuyURL: "https://tienda.com/" + strings.Repeat("a", maxURLLength)},
+	} {
+		_, err := normalizeProducts([]Product{invalid})
+		require.Error(t, err, invalid.Name)
+	}
+
+	t.Setenv("MAX_PRODUCTS", "2")
+	_, err = normalizeProducts([]Product{{Name: "A"}, {Name: "B"}, {Name: "C"}})
+	require.ErrorContains(t, err, "como máximo 2 productos")
+}
+
+func TestRecommendationTemplateProductDetails(t *testing.T) {
+	products, err := normalizeProducts([]Product{
+		{
+			Name: "Auriculares", BuyURL: "https://tienda.com/a", Currency: "CLP",
+			Price: 39990, OriginalPrice: 49990, Rating: 4.5, Stock: StockLow,
+			Badges: []string{"Nuevo", "Envío gratis"}, SKU: "AUR-001",
+		},
+		{Name: "Cable", BuyURL: "https://tienda.com/b"},
+	})
+	require.NoError(t, err)
+
+	data, err := recommendationData(RecommendationRequest{Products: products, Locale: "es"}, nil)
+	require.NoError(t, err)
+	html, err := generateRecommendationHTML(data)
+	require.NoError(t, err)
+	require.Contains(t, html, `<span class="original-price">$49.990</span> $39.990 <span class="discount-badge">-20%</span>`)
+	require.Contains(t, html, "★★★★★ 4,5")
+	require.Contains(t, html, "Últimas unidades")
+	require.Contains(t, html, `<span class="badge">Envío gratis</span>`)
+	require.Contains(t, html, "SKU: AUR-001")
+	require.Equal(t, 1, strings.Count(html, `<div class="price">`))
+}
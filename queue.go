@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"email-api/mail"
+)
+
+// Mensaje en cola guardado como un archivo JSON en el directorio de la cola
+type queuedMessage struct {
+	ID          string       `json:"id"`
+	Batch       string       `json:"batch,omitempty"`
+	RequestID   string       `json:"request_id,omitempty"`
+	TraceParent string       `json:"traceparent,omitempty"`
+	Message     mail.Message `json:"message"`
+	// Un lote sin expandir en vez de un mensaje; ver expandBatch
+	Job       *batchJob `json:"job,omitempty"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Cola de envíos respaldada en disco para que los lotes sobrevivan a un reinicio.
+// Los mensajes que agotan los reintentos se mueven a failed/.
+type sendQueue struct {
+	dir         string
+	send        func(ctx context.Context, msg mail.Message) error
+	maxAttempts int
+	retryDelay  time.Duration
+
+	mu      sync.Mutex
+	pending []string
+	// Cuándo se encoló cada mensaje que aún no se envía ni se descarta,
+	// incluidos los que esperan un reintento
+	enqueued map[string]time.Time
+	notify   chan struct{}
+	wg       sync.WaitGroup
+
+	// Se cierra en Shutdown para que los workers no tomen más mensajes
+	stopping chan struct{}
+	stopOnce sync.Once
+	// Cancela los envíos en curso si el apagado no alcanza a esperarlos
+	cancel context.CancelFunc
+}
+
+var queue *sendQueue
+
+// Configuración desde QUEUE_DIR, QUEUE_MAX_ATTEMPTS y QUEUE_RETRY_DELAY
+func newSendQueueFromEnv() (*sendQueue, error) {
+	dir := os.Getenv("QUEUE_DIR")
+	if dir == "" {
+		dir = "data/queue"
+	}
+	retryDelay, err := time.ParseDuration(os.Getenv("QUEUE_RETRY_DELAY"))
+	if err != nil || retryDelay <= 0 {
+		retryDelay = time.Minute
+	}
+	return newSendQueue(dir, sendWithConfiguredSender, int(envInt64("QUEUE_MAX_ATTEMPTS", 3)), retryDelay)
+}
+
+// Crear la cola y recuperar los mensajes pendientes de una ejecución anterior
+func newSendQueue(dir string, send func(context.Context, mail.Message) error, maxAttempts int, retryDelay time.Duration) (*sendQueue, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "failed"), 0o755); err != nil {
+		return nil, err
+	}
+	q := &sendQueue{
+		dir:         dir,
+		send:        send,
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		enqueued:    make(map[string]time.Time),
+		notify:      make(chan struct{}, 1),
+		stopping:    make(chan struct{}),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			q.pending = append(q.pending, id)
+			q.enqueued[id] = time.Now()
+			if info, err := entry.Info(); err == nil {
+				q.enqueued[id] = info.ModTime()
+			}
+		}
+	}
+	if len(q.pending) > 0 {
+		slog.Info("mensajes pendientes recuperados de la cola", "pending", len(q.pending))
+	}
+	return q, nil
+}
+
+func sendWithConfiguredSender(ctx context.Context, msg mail.Message) error {
+	sender, ok := configuredSender()
+	if !ok {
+		return errors.New("falta configuración de email")
+	}
+	return sender.Send(ctx, msg)
+}
+
+func newQueueID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (q *sendQueue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+// Guardar el mensaje en disco y dejarlo disponible para los workers. El ID de
+// la petición y el traceparent de ctx se guardan para los logs y la traza del envío.
+func (q *sendQueue) Enqueue(ctx context.Context, batch string, msg mail.Message) (string, error) {
+	return q.enqueue(ctx, queuedMessage{Batch: batch, Message: msg})
+}
+
+// Guardar un lote para que los workers armen y encolen el mensaje de cada
+// contacto fuera de la petición
+func (q *sendQueue) EnqueueBatch(ctx context.Context, batch string, job batchJob) (string, error) {
+	return q.enqueue(ctx, queuedMessage{Batch: batch, Job: &job})
+}
+
+func (q *sendQueue) enqueue(ctx context.Context, item queuedMessage) (string, error) {
+	item.ID = newQueueID()
+	item.RequestID = mail.RequestIDFrom(ctx)
+	item.TraceParent = traceParentFrom(ctx)
+	item.CreatedAt = time.Now().UTC()
+	if err := writeJSONFile(q.path(item.ID), item); err != nil {
+		return "", err
+	}
+	q.mu.Lock()
+	q.enqueued[item.ID] = item.CreatedAt
+	q.mu.Unlock()
+	q.push(item.ID)
+	return item.ID, nil
+}
+
+func (q *sendQueue) push(id string) {
+	q.mu.Lock()
+	q.pending = append(q.pending, id)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *sendQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return "", false
+	}
+	id := q.pending[0]
+	q.pending = q.pending[1:]
+	if len(q.pending) > 0 {
+		// Despertar a otro worker para el siguiente mensaje
+		select {
+		case q.notify <- struct{}{}:
+		default:
+		}
+	}
+	return id, true
+}
+
+// Iniciar los workers; se detienen cuando se cancela ctx o con Shutdown
+func (q *sendQueue) Start(ctx context.Context, workers int) {
+	ctx, cancel := context.WithCancel(ctx)
+	q.mu.Lock()
+	q.cancel = cancel
+	q.mu.Unlock()
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *sendQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stopping:
+			return
+		default:
+		}
+		id, ok := q.pop()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.stopping:
+				return
+			case <-q.notify:
+				continue
+			}
+		}
+		if err := q.process(ctx, id); err != nil {
+			slog.Error("error en la cola", "queue_id", id, "error", err)
+		}
+	}
+}
+
+// Enviar un mensaje y borrarlo, reintentarlo o moverlo a failed/
+func (q *sendQueue) process(ctx context.Context, id string) error {
+	data, err := os.ReadFile(q.path(id))
+	if err != nil {
+		return err
+	}
+	var item queuedMessage
+	if err := json.Unmarshal(data, &item); err != nil {
+		q.done(id)
+		return os.Rename(q.path(id), filepath.Join(q.dir, "failed", id+".json"))
+	}
+
+	if item.RequestID != "" {
+		ctx = mail.WithRequestID(ctx, item.RequestID)
+	}
+	ctx = withTraceParent(ctx, item.TraceParent)
+	if item.Job != nil {
+		return q.expandBatch(ctx, item)
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	err = q.send(sendCtx, item.Message)
+	cancel()
+	if err == nil {
+		q.done(id)
+		return os.Remove(q.path(id))
+	}
+	if ctx.Err() != nil {
+		// Apagado: el mensaje queda en disco sin contar el intento
+		slog.WarnContext(ctx, "envío interrumpido, se reintentará al reiniciar", "queue_id", id)
+		return nil
+	}
+
+	item.Attempts++
+	item.LastError = err.Error()
+	if err := writeJSONFile(q.path(id), item); err != nil {
+		return err
+	}
+	if item.Attempts >= q.maxAttempts {
+		slog.ErrorContext(ctx, "mensaje descartado", "queue_id", id, "attempts", item.Attempts, "error", err)
+		q.done(id)
+		return os.Rename(q.path(id), filepath.Join(q.dir, "failed", id+".json"))
+	}
+
+	delay := q.retryDelay * time.Duration(item.Attempts)
+	slog.WarnContext(ctx, "reintentando mensaje", "queue_id", id, "delay", delay.String(), "error", err)
+	time.AfterFunc(delay, func() { q.push(id) })
+	return nil
+}
+
+// Shutdown deja de tomar mensajes y espera los envíos en curso. Si ctx vence
+// antes, los cancela; esos mensajes quedan en disco para el próximo arranque.
+func (q *sendQueue) Shutdown(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.stopping) })
+
+	finished := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	cancel := q.cancel
+	q.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	<-finished
+	return ctx.Err()
+}
+
+// Cantidad de mensajes esperando en la cola
+func (q *sendQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+func (q *sendQueue) done(id string) {
+	q.mu.Lock()
+	delete(q.enqueued, id)
+	q.mu.Unlock()
+}
+
+// Mensajes sin entregar (pendientes o esperando un reintento) y antigüedad
+// del más viejo
+func (q *sendQueue) Stats() (int, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var oldest time.Duration
+	for _, at := range q.enqueued {
+		if age := time.Since(at); age > oldest {
+			oldest = age
+		}
+	}
+	return len(q.enqueued), oldest
+}
+
+// Comprueba que se pueda escribir en el directorio de la cola
+func (q *sendQueue) CheckWritable() error {
+	f, err := os.CreateTemp(q.dir, ".check-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_, err = f.Write([]byte("ok"))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+	return err
+}
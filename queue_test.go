@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"email-api/mail"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Registra los envíos y falla para los destinatarios indicados
+type recordingSend struct {
+	mu   sync.Mutex
+	sent []string
+	fail map[string]bool
+}
+
+func (s *recordingSend) Send(ctx context.Context, msg mail.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	to := msg.To[0].Address
+	if s.fail[to] {
+		return errors.New("buzón lleno")
+	}
+	s.sent = append(s.sent, to)
+	return nil
+}
+
+func (s *recordingSend) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+func testQueueMessage(t *testing.T, to string) mail.Message {
+	msg, err := mail.NewMessage().To(to).Subject("Hola").Text("Hola").Build()
+	require.NoError(t, err)
+	return msg
+}
+
+func TestSendQueue(t *testing.T) {
+	dir := t.TempDir()
+	send := &recordingSend{fail: map[string]bool{"lleno@ejemplo.com": true}}
+	q, err := newSendQueue(dir, send.Send, 2, time.Millisecond)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx, 2)
+
+	for _, to := range []string{"a@ejemplo.com", "b@ejemplo.com", "lleno@ejemplo.com"} {
+		_, err := q.Enqueue(context.Background(), "lote", testQueueMessage(t, to))
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		failed, _ := os.ReadDir(filepath.Join(dir, "failed"))
+		return send.count() == 2 && len(failed) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	pending, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestSendQueueRecoversPending(t *testing.T) {
+	dir := t.TempDir()
+	first, err := newSendQueue(dir, nil, 3, time.Millisecond)
+	require.NoError(t, err)
+	_, err = first.Enqueue(context.Background(), "", testQueueMessage(t, "a@ejemplo.com"))
+	require.NoError(t, err)
+
+	// Un reinicio sin haber iniciado los workers no pierde el mensaje
+	send := &recordingSend{}
+	second, err := newSendQueue(dir, send.Send, 3, time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, 1, second.Len())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	second.Start(ctx, 1)
+	require.Eventually(t, func() bool { return send.count() == 1 }, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestSendQueueShutdown(t *testing.T) {
+	dir := t.TempDir()
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	send := func(ctx context.Context, msg mail.Message) error {
+		started <- struct{}{}
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	q, err := newSendQueue(dir, send, 3, time.Millisecond)
+	require.NoError(t, err)
+	q.Start(context.Background(), 1)
+
+	first, err := q.Enqueue(context.Background(), "", testQueueMessage(t, "a@ejemplo.com"))
+	require.NoError(t, err)
+	second, err := q.Enqueue(context.Background(), "", testQueueMessage(t, "b@ejemplo.com"))
+	require.NoError(t, err)
+	<-started
+
+	// El envío en curso termina; el siguiente no se toma
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	require.NoError(t, q.Shutdown(context.Background()))
+	require.NoFileExists(t, q.path(first))
+	require.FileExists(t, q.path(second))
+	require.Len(t, started, 0)
+}
+
+func TestSendQueueShutdownDeadline(t *testing.T) {
+	dir := t.TempDir()
+	started := make(chan struct{}, 1)
+	send := func(ctx context.Context, msg mail.Message) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	q, err := newSendQueue(dir, send, 3, time.Millisecond)
+	require.NoError(t, err)
+	q.Start(context.Background(), 1)
+
+	id, err := q.Enqueue(context.Background(), "", testQueueMessage(t, "a@ejemplo.com"))
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.Shutdown(ctx), context.DeadlineExceeded)
+
+	// El mensaje interrumpido sigue en disco sin contar el intento
+	data, err := os.ReadFile(q.path(id))
+	require.NoError(t, err)
+	var item queuedMessage
+	require.NoError(t, json.Unmarshal(data, &item))
+	require.Zero(t, item.Attempts)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"email-api/mail"
+)
+
+// Versión fijada al compilar con -ldflags "-X main.version=1.2.3"; si no, se
+// toma de la información de compilación
+var version string
+
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	var revision string
+	var modified bool
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// Estado de un componente en /readyz
+type CheckResult struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Critical   bool      `json:"critical"`
+	CheckedAt  time.Time `json:"checked_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// Sin la configuración necesaria el componente no se revisa
+var errCheckSkipped = errors.New("no configurado")
+
+// Revisión de un componente. El resultado se guarda durante ttl para que las
+// sondas frecuentes no abran una sesión SMTP en cada llamada.
+type readinessCheck struct {
+	name     string
+	critical bool
+	ttl      time.Duration
+	run      func(ctx context.Context) error
+
+	mu     sync.Mutex
+	result CheckResult
+}
+
+func (c *readinessCheck) check(ctx context.Context) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.result.CheckedAt.IsZero() && time.Since(c.result.CheckedAt) < c.ttl {
+		return c.result
+	}
+
+	start := time.Now()
+	err := c.run(ctx)
+	result := CheckResult{Status: "ok", Critical: c.critical, CheckedAt: start, DurationMs: time.Since(start).Milliseconds()}
+	switch {
+	case errors.Is(err, errCheckSkipped):
+		result.Status = "skipped"
+	case err != nil:
+		result.Status = "error"
+		result.Error = err.Error()
+		slog.WarnContext(ctx, "revisión de disponibilidad fallida", "check", c.name, "error", err)
+	}
+	// Si se canceló la sonda (p. ej. el cliente se desconectó) el error no dice
+	// nada del componente y no debe quedar guardado durante todo el ttl
+	if ctx.Err() == nil {
+		c.result = result
+	}
+	return result
+}
+
+type ReadinessResponse struct {
+	Status  string                 `json:"status"`
+	Version string                 `json:"version"`
+	Checks  map[string]CheckResult `json:"checks"`
+}
+
+// Tiempo máximo de cada revisión
+const readinessCheckTimeout = 5 * time.Second
+
+// Revisa todos los componentes en paralelo. "unavailable" si falla uno
+// crítico, "degraded" si falla uno que no lo es.
+func checkReadiness(ctx context.Context, checks []*readinessCheck) ReadinessResponse {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	response := ReadinessResponse{Status: "ok", Version: buildVersion(), Checks: map[string]CheckResult{}}
+	for i, c := range checks {
+		response.Checks[c.name] = results[i]
+		if results[i].Status != "error" {
+			continue
+		}
+		if results[i].Critical {
+			response.Status = "unavailable"
+		} else if response.Status == "ok" {
+			response.Status = "degraded"
+		}
+	}
+	return response
+}
+
+// READYZ_CACHE_TTL controla cada cuánto se repiten las revisiones (60s por
+// defecto). Gmail bloquea temporalmente las cuentas con demasiados AUTH.
+func newReadinessChecks() []*readinessCheck {
+	ttl, err := time.ParseDuration(os.Getenv("READYZ_CACHE_TTL"))
+	if err != nil || ttl < 0 {
+		ttl = time.Minute
+	}
+	return []*readinessCheck{
+		{name: "smtp", critical: true, ttl: ttl, run: checkSMTP},
+		{name: "queue", critical: true, ttl: ttl, run: checkQueue},
+		{name: "call_api", ttl: ttl, run: checkCallAPI},
+	}
+}
+
+// Conexión, EHLO y AUTH con las credenciales configuradas, sin enviar nada
+func checkSMTP(ctx context.Context) error {
+	address := os.Getenv("EMAIL_SENDER_ADDRESS")
+	password := os.Getenv("EMAIL_SENDER_PASSWORD")
+	if address == "" || !emailCredentialsConfigured(password) {
+		return errCheckSkipped
+	}
+	sender := mail.NewGmailSender(os.Getenv("EMAIL_SENDER_NAME"), address, password, senderOptions...)
+	verifier, ok := sender.(mail.Verifier)
+	if !ok {
+		return errCheckSkipped
+	}
+	return verifier.Verify(ctx)
+}
+
+func checkQueue(ctx context.Context) error {
+	if queue == nil {
+		return errCheckSkipped
+	}
+	return queue.CheckWritable()
+}
+
+// Solo se abre una conexión TCP: una petición real iniciaría una llamada
+func checkCallAPI(ctx context.Context) error {
+	u, err := url.Parse(phoneCallAPIURL)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Se configuran en main
+var readinessChecks []*readinessCheck
+
+// El proceso está vivo; no revisa dependencias
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "version": buildVersion()})
+}
+
+// Listo para recibir tráfico: 503 si falla un componente crítico
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	response := checkReadiness(r.Context(), readinessChecks)
+	status := http.StatusOK
+	if response.Status == "unavailable" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReadiness(t *testing.T) {
+	calls := 0
+	smtpErr := errors.New("535 5.7.8 Username and Password not accepted")
+	checks := []*readinessCheck{
+		{name: "smtp", critical: true, ttl: time.Minute, run: func(ctx context.Context) error {
+			calls++
+			return nil
+		}},
+		{name: "call_api", ttl: time.Minute, run: func(ctx context.Context) error { return errors.New("connection refused") }},
+		{name: "queue", critical: true, ttl: time.Minute, run: func(ctx context.Context) error { return errCheckSkipped }},
+	}
+
+	response := checkReadiness(context.Background(), checks)
+	require.Equal(t, "degraded", response.Status)
+	require.Equal(t, "ok", response.Checks["smtp"].Status)
+	require.Equal(t, "error", response.Checks["call_api"].Status)
+	require.Equal(t, "connection refused", response.Checks["call_api"].Error)
+	require.Equal(t, "skipped", response.Checks["queue"].Status)
+
+	// El resultado se reutiliza mientras no venza el ttl
+	checkReadiness(context.Background(), checks)
+	require.Equal(t, 1, calls)
+
+	checks[0].ttl = 0
+	checks[0].run = func(ctx context.Context) error { return smtpErr }
+	response = checkReadiness(context.Background(), checks)
+	require.Equal(t, "unavailable", response.Status)
+	require.Equal(t, smtpErr.Error(), response.Checks["smtp"].Error)
+	require.True(t, response.Checks["smtp"].Critical)
+}
+
+func TestReadinessCheckSkipsCacheOnCancel(t *testing.T) {
+	calls := 0
+	check := &readinessCheck{name: "smtp", critical: true, ttl: time.Minute, run: func(ctx context.Context) error {
+		calls++
+		return ctx.Err()
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, "error", check.check(ctx).Status)
+
+	// La siguiente sonda vuelve a revisar en vez de reutilizar el error
+	require.Equal(t, "ok", check.check(context.Background()).Status)
+	require.Equal(t, "ok", check.check(context.Background()).Status)
+	require.Equal(t, 2, calls)
+}
+
+func TestReadyzHandler(t *testing.T) {
+	saved := readinessChecks
+	t.Cleanup(func() { readinessChecks = saved })
+	readinessChecks = []*readinessCheck{
+		{name: "smtp", critical: true, run: func(ctx context.Context) error { return errors.New("dial tcp: i/o timeout") }},
+	}
+
+	rec := httptest.NewRecorder()
+	readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var response ReadinessResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	require.Equal(t, "unavailable", response.Status)
+	require.NotEmpty(t, response.Version)
+
+	rec = httptest.NewRecorder()
+	livezHandler(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestReadinessComponentChecks(t *testing.T) {
+	q, err := newSendQueue(t.TempDir(), nil, 1, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, q.CheckWritable())
+	entries, err := os.ReadDir(q.dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1) // solo failed/
+
+	api := httptest.NewServer(http.NotFoundHandler())
+	saved := phoneCallAPIURL
+	t.Cleanup(func() { phoneCallAPIURL = saved })
+	phoneCallAPIURL = api.URL + "/api/v1/phonecalls/make_call_body"
+	require.NoError(t, checkCallAPI(context.Background()))
+
+	api.Close()
+	require.Error(t, checkCallAPI(context.Background()))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"strings"
+
+	"email-api/mail"
+)
+
+// Destinatario con nombre visible opcional
+type Recipient struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Aceptar tanto {"email": ..., "name": ...} como "Nombre <email>"
+func (r *Recipient) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		*r = Recipient{Email: raw}
+		return nil
+	}
+	type plain Recipient
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// Validar la dirección y devolverla con su nombre
+func (r Recipient) Address() (*netmail.Address, error) {
+	addr, err := netmail.ParseAddress(r.Email)
+	if err != nil {
+		return nil, fmt.Errorf("dirección inválida %q: %v", r.Email, err)
+	}
+	if r.Name != "" {
+		addr.Name = r.Name
+	}
+	return addr, nil
+}
+
+// Dirección en formato RFC 5322 con el nombre visible
+func (r Recipient) String() string {
+	addr, err := r.Address()
+	if err != nil {
+		return r.Email
+	}
+	return addr.String()
+}
+
+// Campos de destinatarios compartidos por las peticiones de envío
+type RecipientFields struct {
+	To      []Recipient `json:"to,omitempty"`
+	Cc      []Recipient `json:"cc,omitempty"`
+	Bcc     []Recipient `json:"bcc,omitempty"`
+	ReplyTo *Recipient  `json:"reply_to,omitempty"`
+}
+
+// Destinatarios validados y sin duplicados
+type resolvedRecipients struct {
+	To      []*netmail.Address
+	Cc      []*netmail.Address
+	Bcc     []*netmail.Address
+	ReplyTo *netmail.Address
+}
+
+var errInvalidRecipients = errors.New("destinatarios inválidos")
+
+// Máximo de destinatarios (to + cc + bcc) por petición
+func loadMaxRecipients() int {
+	return int(envInt64("MAX_RECIPIENTS", 50))
+}
+
+// Validar y deduplicar los destinatarios. Si no hay ningún "to" se usa
+// fallback (por ejemplo DESTINATION_EMAIL). Una dirección repetida se queda
+// en la primera lista donde aparece, en el orden to, cc, bcc.
+func resolveRecipients(fields RecipientFields, fallback string, max int) (resolvedRecipients, error) {
+	var resolved resolvedRecipients
+	var errs []error
+
+	to := fields.To
+	if len(to) == 0 && fallback != "" {
+		to = []Recipient{{Email: fallback}}
+	}
+
+	seen := make(map[string]bool)
+	add := func(list []Recipient) []*netmail.Address {
+		var addrs []*netmail.Address
+		for _, recipient := range list {
+			addr, err := recipient.Address()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			key := strings.ToLower(addr.Address)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			addrs = append(addrs, addr)
+		}
+		return addrs
+	}
+	resolved.To = add(to)
+	resolved.Cc = add(fields.Cc)
+	resolved.Bcc = add(fields.Bcc)
+
+	if fields.ReplyTo != nil {
+		addr, err := fields.ReplyTo.Address()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reply_to: %v", err))
+		}
+		resolved.ReplyTo = addr
+	}
+
+	if len(errs) > 0 {
+		return resolved, fmt.Errorf("%w: %v", errInvalidRecipients, errors.Join(errs...))
+	}
+	switch count := resolved.Count(); {
+	case count == 0:
+		return resolved, fmt.Errorf("%w: se requiere al menos un destinatario", errInvalidRecipients)
+	case count > max:
+		return resolved, fmt.Errorf("%w: %d destinatarios, el máximo es %d", errInvalidRecipients, count, max)
+	}
+	return resolved, nil
+}
+
+func (r resolvedRecipients) Count() int {
+	return len(r.To) + len(r.Cc) + len(r.Bcc)
+}
+
+// Agregar los destinatarios al mensaje
+func (r resolvedRecipients) Apply(builder *mail.MessageBuilder) *mail.MessageBuilder {
+	for _, addr := range r.To {
+		builder.To(addr.String())
+	}
+	for _, addr := range r.Cc {
+		builder.Cc(addr.String())
+	}
+	for _, addr := range r.Bcc {
+		builder.Bcc(addr.String())
+	}
+	if r.ReplyTo != nil {
+		builder.ReplyTo(r.ReplyTo.String())
+	}
+	return builder
+}
+
+// Destinatarios de un campo de formulario: se puede repetir o separar por comas
+func formRecipients(values []string) []Recipient {
+	var recipients []Recipient
+	for _, value := range values {
+		addrs, err := netmail.ParseAddressList(value)
+		if err != nil {
+			// Se deja tal cual para que resolveRecipients informe el error
+			recipients = append(recipients, Recipient{Email: value})
+			continue
+		}
+		for _, addr := range addrs {
+			recipients = append(recipients, Recipient{Email: addr.Address, Name: addr.Name})
+		}
+	}
+	return recipients
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"email-api/mail"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecipientUnmarshal(t *testing.T) {
+	var req EmailRequest
+	err := json.Unmarshal([]byte(`{
+		"subject": "Hola",
+		"to": ["Juan Pérez <juan@ejemplo.com>", {"email": "ana@ejemplo.com", "name": "Ana"}],
+		"reply_to": {"email": "soporte@tienda.com"}
+	}`), &req)
+	require.NoError(t, err)
+	require.Equal(t, []Recipient{{Email: "Juan Pérez <juan@ejemplo.com>"}, {Email: "ana@ejemplo.com", Name: "Ana"}}, req.To)
+	require.Equal(t, "soporte@tienda.com", req.ReplyTo.Email)
+}
+
+func TestResolveRecipients(t *testing.T) {
+	resolved, err := resolveRecipients(RecipientFields{
+		To:      []Recipient{{Email: "Juan <juan@ejemplo.com>"}, {Email: "ana@ejemplo.com", Name: "Ana"}},
+		Cc:      []Recipient{{Email: "JUAN@ejemplo.com"}, {Email: "jefe@ejemplo.com"}},
+		Bcc:     []Recipient{{Email: "jefe@ejemplo.com"}, {Email: "archivo@tienda.com"}},
+		ReplyTo: &Recipient{Email: "soporte@tienda.com"},
+	}, "destino@ejemplo.com", 10)
+	require.NoError(t, err)
+	require.Equal(t, 4, resolved.Count())
+	require.Equal(t, "Juan", resolved.To[0].Name)
+	require.Equal(t, "Ana", resolved.To[1].Name)
+	require.Len(t, resolved.Cc, 1)
+	require.Equal(t, "archivo@tienda.com", resolved.Bcc[0].Address)
+
+	msg, err := resolved.Apply(mail.NewMessage()).Subject("Hola").HTML("<p>Hola</p>").Build()
+	require.NoError(t, err)
+	require.Equal(t, "Juan", msg.To[0].Name)
+	require.Equal(t, "soporte@tienda.com", msg.ReplyTo[0].Address)
+}
+
+func TestResolveRecipientsFallback(t *testing.T) {
+	resolved, err := resolveRecipients(RecipientFields{Cc: []Recipient{{Email: "jefe@ejemplo.com"}}}, "destino@ejemplo.com", 10)
+	require.NoError(t, err)
+	require.Equal(t, "destino@ejemplo.com", resolved.To[0].Address)
+	require.Equal(t, "jefe@ejemplo.com", resolved.Cc[0].Address)
+}
+
+func TestResolveRecipientsRejects(t *testing.T) {
+	tests := map[string]RecipientFields{
+		"sin destinatarios":  {},
+		"dirección inválida": {To: []Recipient{{Email: "no-es-un-email"}}},
+		"reply_to inválido":  {To: []Recipient{{Email: "a@ejemplo.com"}}, ReplyTo: &Recipient{Email: "x"}},
+		"demasiados": {
+			To:  []Recipient{{Email: "a@ejemplo.com"}, {Email: "b@ejemplo.com"}},
+			Bcc: []Recipient{{Email: "c@ejemplo.com"}, {Email: "d@ejemplo.com"}},
+		},
+	}
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := resolveRecipients(fields, "", 3)
+			require.True(t, errors.Is(err, errInvalidRecipients), err)
+		})
+	}
+}
+
+func TestFormRecipients(t *testing.T) {
+	recipients := formRecipients([]string{`"Pérez, Juan" <juan@ejemplo.com>, ana@ejemplo.com`, "no válido"})
+	require.Equal(t, []Recipient{
+		{Email: "juan@ejemplo.com", Name: "Pérez, Juan"},
+		{Email: "ana@ejemplo.com"},
+		{Email: "no válido"},
+	}, recipients)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Prefijo de la versión actual de la API
+const apiPrefix = "/api/v1"
+
+// Fecha (RFC 9745) desde la que las rutas sin /api/v1 están obsoletas:
+// 2026-10-19T00:00:00Z
+const legacyDeprecation = "@1792368000"
+
+// Ruta de la API. path va después de /api/v1 y usa los comodines de
+// http.ServeMux; legacy es la ruta anterior, que sigue respondiendo como alias
+// obsoleto; body indica los tipos de contenido y el tamaño que acepta.
+type apiRoute struct {
+	method  string
+	path    string
+	legacy  string
+	body    bodyPolicy
+	handler http.HandlerFunc
+}
+
+var apiRoutes = []apiRoute{
+	{http.MethodPost, "/send-email", "/send-email", emailBody, sendEmailHandler},
+	{http.MethodPost, "/send", "/v2/send", attachmentBody, sendHandler},
+	{http.MethodPost, "/contact", "/contact", formBody, contactFormHandler},
+
+	{http.MethodPost, "/recommendations", "/recommendations", attachmentBody, sendRecommendationHandler},
+	{http.MethodPost, "/recommendations/batch", "/recommendations/batch", jsonBody, batchRecommendationHandler},
+
+	{http.MethodGet, "/contacts", "/contacts", noBody, listContactsHandler},
+	{http.MethodPost, "/contacts", "/contacts", jsonBody, createContactHandler},
+	{http.MethodGet, "/contacts/{email}", "/contacts/{email}", noBody, getContactHandler},
+	{http.MethodPut, "/contacts/{email}", "/contacts/{email}", jsonBody, updateContactHandler},
+	{http.MethodDelete, "/contacts/{email}", "/contacts/{email}", noBody, deleteContactHandler},
+	{http.MethodPost, "/contacts/import", "/contacts/import", csvBody, contactsImportHandler},
+	{http.MethodGet, "/contacts/export", "/contacts/export", noBody, contactsExportHandler},
+
+	{http.MethodGet, "/themes", "/themes", noBody, listThemesHandler},
+	{http.MethodGet, "/themes/{name}", "/themes/{name}", noBody, getThemeHandler},
+	{http.MethodPut, "/themes/{name}", "/themes/{name}", jsonBody, saveThemeHandler},
+	{http.MethodDelete, "/themes/{name}", "/themes/{name}", noBody, deleteThemeHandler},
+
+	{http.MethodGet, "/templates/{name}/lint", "/templates/{name}/lint", noBody, templateLintHandler},
+	{http.MethodPost, "/templates/{name}/lint", "/templates/{name}/lint", jsonBody, templateLintHandler},
+
+	{http.MethodGet, "/call-action", "/call-action", noBody, callActionHandler},
+	{http.MethodPost, "/call-action", "/call-action", jsonBody, callActionHandler},
+
+	{http.MethodPost, "/calendar-invite", "/calendar-invite", jsonBody, calendarInviteHandler},
+	{http.MethodPut, "/calendar-invite", "/calendar-invite", jsonBody, calendarInviteHandler},
+	{http.MethodDelete, "/calendar-invite", "/calendar-invite", noBody, calendarInviteHandler},
+}
+
+// Router con método y ruta (Go 1.22). Las rutas que no existen responden 404
+// y los métodos no soportados 405 con el encabezado Allow.
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, route := range apiRoutes {
+		handler := limitBody(route.body, route.handler)
+		mux.Handle(route.method+" "+apiPrefix+route.path, handler)
+		if route.legacy != "" {
+			mux.Handle(route.method+" "+route.legacy, deprecated(apiPrefix+route.path, handler))
+		}
+	}
+
+	// Operación: fuera de /api/v1 porque no son parte de la API
+	mux.HandleFunc("GET /livez", livezHandler)
+	mux.HandleFunc("GET /readyz", readyzHandler)
+	mux.Handle("GET /metrics", metricsHandler())
+	mux.Handle("GET /health", deprecated("/livez", http.HandlerFunc(healthCheckHandler)))
+
+	// Documentación
+	mux.HandleFunc("GET /openapi.json", openAPIHandler)
+	mux.HandleFunc("GET /docs", docsHandler)
+	return mux
+}
+
+// Alias obsoleto: responde igual que la ruta nueva y la indica en Link
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := expandPattern(successor, r)
+		w.Header().Set("Deprecation", legacyDeprecation)
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		slog.DebugContext(r.Context(), "ruta obsoleta", "path", r.URL.Path, "successor", successor)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reemplaza los comodines de un patrón por los valores de la petición:
+// /api/v1/contacts/{email} -> /api/v1/contacts/ana@ejemplo.com
+func expandPattern(pattern string, r *http.Request) string {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			name = strings.TrimSuffix(strings.TrimSuffix(name, "}"), "...")
+			segments[i] = url.PathEscape(r.PathValue(name))
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Ruta de la petición para métricas y trazas, sin el método:
+// "GET /api/v1/contacts/{email}" -> "/api/v1/contacts/{email}"
+func routeOf(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+	return r.Pattern
+}
+
+// CORS para todas las rutas. Las consultas previas (preflight) se responden
+// aquí; el resto de los OPTIONS llega al router, que responde 405.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Request-ID, traceparent")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Deprecation, Link")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
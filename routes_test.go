@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	handler := withCORS(newRouter())
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/api/v1/themes")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Deprecation"))
+
+	// Las rutas anteriores siguen respondiendo, marcadas como obsoletas
+	rec = serve(http.MethodGet, "/themes/default")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, legacyDeprecation, rec.Header().Get("Deprecation"))
+	require.Equal(t, `</api/v1/themes/default>; rel="successor-version"`, rec.Header().Get("Link"))
+
+	rec = serve(http.MethodGet, "/health")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, `</livez>; rel="successor-version"`, rec.Header().Get("Link"))
+
+	// La raíz y las rutas mal escritas ya no responden como health check
+	require.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/").Code)
+	require.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/api/v1/recomendations").Code)
+
+	rec = serve(http.MethodGet, "/api/v1/send")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, "POST", rec.Header().Get("Allow"))
+
+	rec = serve(http.MethodPatch, "/api/v1/contacts/ana@ejemplo.com")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, "DELETE, GET, HEAD, PUT", rec.Header().Get("Allow"))
+
+	// Consulta previa de CORS
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/send", nil)
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestExpandPattern(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/contacts/ana@ejemplo.com", nil)
+	req.SetPathValue("email", "ana@ejemplo.com")
+	require.Equal(t, "/api/v1/contacts/ana@ejemplo.com", expandPattern("/api/v1/contacts/{email}", req))
+	require.Equal(t, "/api/v1/send", expandPattern("/api/v1/send", req))
+}
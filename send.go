@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"email-api/mail"
+)
+
+// Petición de envío v2: el llamador indica destinatarios, contenido y datos
+type SendRequest struct {
+	RecipientFields
+	Subject string         `json:"subject"`
+	HTML    string         `json:"html,omitempty"`
+	Text    string         `json:"text,omitempty"`
+	Data    map[string]any `json:"data,omitempty"`
+	Locale  string         `json:"locale,omitempty"`
+	Brand   string         `json:"brand,omitempty"`
+	Tags    []string       `json:"tags,omitempty"`
+
+	Attachments []AttachmentRequest `json:"attachments,omitempty"`
+}
+
+// Respuesta del envío v2
+type SendResponse struct {
+	Status     string `json:"status"`
+	Recipients int    `json:"recipients"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Handler para el envío v2 a los destinatarios indicados en la petición
+func sendHandler(w http.ResponseWriter, r *http.Request) {
+	var req SendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
+		return
+	}
+	if req.Subject == "" || (req.HTML == "" && req.Text == "") {
+		http.Error(w, "subject y html o text son requeridos", http.StatusBadRequest)
+		return
+	}
+	if err := req.checkTextLimits(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A diferencia de /send-email no hay destinatario por defecto
+	recipients, err := resolveRecipients(req.RecipientFields, "", loadMaxRecipients())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	attachments, err := decodeAttachments(req.Attachments, loadAttachmentLimits())
+	if err != nil {
+		http.Error(w, err.Error(), attachmentErrorStatus(err))
+		return
+	}
+	theme, err := themes.Resolve(req.Brand)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc := resolveLocale(req.Locale)
+	data := make(map[string]any, len(req.Data)+2)
+	for key, value := range req.Data {
+		data[key] = value
+	}
+	data["locale"] = loc.Code
+	data["theme"] = theme.view(loc)
+	_, span := tracer.Start(r.Context(), "render content")
+	content, err := renderContent(emailContent{Subject: req.Subject, HTML: req.HTML, Text: req.Text}, data)
+	if err == nil && content.HTML != "" {
+		content.HTML = prepareEmailHTML(content.HTML)
+	}
+	endSpan(span, err)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error en la plantilla: %v", err), http.StatusBadRequest)
+		return
+	}
+	if content.HTML != "" {
+		lintRendered("send", content.HTML, content.Text)
+	}
+
+	sender, ok := configuredSender()
+	if !ok {
+		slog.WarnContext(r.Context(), "configuración de email no encontrada, respondiendo sin enviar")
+		writeJSON(w, http.StatusOK, SendResponse{Status: "not_configured", Recipients: recipients.Count()})
+		return
+	}
+
+	builder := recipients.Apply(mail.NewMessage()).
+		Subject(content.Subject).
+		HTML(content.HTML).
+		Text(content.Text).
+		Tag("send")
+	builder.Tag(req.Tags...)
+	for _, a := range attachments {
+		builder.Attach(a.Filename, a.ContentType, a.Content)
+	}
+	msg, err := builder.Build()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Mensaje inválido: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "enviando email", "recipients", recipients.Count())
+	ctx, cancel := context.WithTimeout(r.Context(), emailSendTimeout)
+	defer cancel()
+	if err := sender.Send(ctx, msg); err != nil {
+		slog.ErrorContext(r.Context(), "error al enviar email", "error", err)
+		http.Error(w, fmt.Sprintf("Error al enviar el correo: %v", err), sendErrorStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SendResponse{Status: "sent", Recipients: recipients.Count()})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderContent(t *testing.T) {
+	content, err := renderContent(emailContent{
+		Subject: "Hola {{.name}}",
+		HTML:    "<p>Hola {{.name}}</p>",
+		Text:    "Hola {{.name}}",
+	}, map[string]any{"name": "<Juan>"})
+	require.NoError(t, err)
+	require.Equal(t, "Hola <Juan>", content.Subject)
+	require.Equal(t, "<p>Hola &lt;Juan&gt;</p>", content.HTML)
+	require.Equal(t, "Hola <Juan>", content.Text)
+
+	_, err = renderContent(emailContent{HTML: "{{.name"}, nil)
+	require.Error(t, err)
+
+	// Un campo inexistente falla en vez de dejar el texto en blanco
+	_, err = renderContent(emailContent{Subject: "Hola {{.apodo}}"}, map[string]any{"name": "Juan"})
+	require.ErrorContains(t, err, "apodo")
+}
+
+func TestSendHandler(t *testing.T) {
+	t.Setenv("EMAIL_SENDER_ADDRESS", "")
+
+	tests := map[string]struct {
+		body   string
+		status int
+	}{
+		"válido":          {`{"to": ["juan@ejemplo.com"], "subject": "Hola", "html": "<p>{{.name}}</p>", "data": {"name": "Juan"}}`, http.StatusOK},
+		"sin to":          {`{"subject": "Hola", "html": "<p>Hola</p>"}`, http.StatusBadRequest},
+		"sin contenido":   {`{"to": ["juan@ejemplo.com"], "subject": "Hola"}`, http.StatusBadRequest},
+		"plantilla rota":  {`{"to": ["juan@ejemplo.com"], "subject": "Hola", "text": "{{.name"}`, http.StatusBadRequest},
+		"JSON inválido":   {`{`, http.StatusBadRequest},
+		"email inválido":  {`{"to": ["juan"], "subject": "Hola", "text": "Hola"}`, http.StatusBadRequest},
+		"cc sin to sirve": {`{"cc": ["jefe@ejemplo.com"], "subject": "Hola", "text": "Hola"}`, http.StatusOK},
+		"falta requerido": {`{"to": ["juan@ejemplo.com"], "subject": "Hola", "text": "{{.name | required \"name\"}}", "data": {"name": ""}}`, http.StatusBadRequest},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			sendHandler(rec, httptest.NewRequest(http.MethodPost, "/v2/send", strings.NewReader(tc.body)))
+			require.Equal(t, tc.status, rec.Code, rec.Body.String())
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	sendHandler(rec, httptest.NewRequest(http.MethodPost, "/v2/send", strings.NewReader(
+		`{"to": ["juan@ejemplo.com", "JUAN@ejemplo.com"], "bcc": ["ana@ejemplo.com"], "subject": "Hola", "text": "Hola"}`)))
+	var resp SendResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, SendResponse{Status: "not_configured", Recipients: 2}, resp)
+}
+
+func TestContactFormHandler(t *testing.T) {
+	t.Setenv("EMAIL_SENDER_ADDRESS", "")
+	t.Setenv("CONTACT_FORM_INBOX", "buzon@tienda.com")
+
+	form := url.Values{"name": {"Juan"}, "email": {"juan@ejemplo.com"}, "message": {"Hola"}}
+	req := httptest.NewRequest(http.MethodPost, "/contact", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	contactFormHandler(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/contact", strings.NewReader(`{"email": "no-es-email", "message": "Hola"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	contactFormHandler(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Sin buzón configurado no es culpa del visitante
+	t.Setenv("CONTACT_FORM_INBOX", "")
+	t.Setenv("DESTINATION_EMAIL", "")
+	req = httptest.NewRequest(http.MethodPost, "/contact", strings.NewReader(`{"email": "juan@ejemplo.com", "message": "Hola"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	contactFormHandler(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "no enviado (falta configuración)")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"email-api/mail"
+)
+
+// Servidor HTTP con timeouts. La escritura debe dar tiempo a un envío SMTP
+// completo (emailSendTimeout) y la lectura a subir los adjuntos. El timeout y
+// el tamaño de los encabezados cortan a los clientes lentos (slowloris).
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: envDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       envDuration("HTTP_READ_TIMEOUT", 60*time.Second),
+		WriteTimeout:      envDuration("HTTP_WRITE_TIMEOUT", 2*emailSendTimeout),
+		IdleTimeout:       envDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+		MaxHeaderBytes:    int(envInt64("HTTP_MAX_HEADER_BYTES", 64<<10)),
+	}
+}
+
+// Atiende hasta recibir SIGINT o SIGTERM y luego apaga ordenadamente dentro
+// de SHUTDOWN_TIMEOUT (25s por defecto, menos que los 30s de Kubernetes)
+func runServer(srv *http.Server, flushTraces func(context.Context) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// Una segunda señal termina el proceso de inmediato
+	stop()
+
+	timeout := envDuration("SHUTDOWN_TIMEOUT", 25*time.Second)
+	slog.Info("apagando servidor", "timeout", timeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return shutdown(shutdownCtx, srv, queue, smtpPool, flushTraces)
+}
+
+// Deja de aceptar conexiones, espera las peticiones en curso y luego los
+// workers de la cola, y recién entonces cierra el pool SMTP. Si ctx vence,
+// corta lo que quede: los mensajes de la cola siguen en disco y se envían en
+// el próximo arranque.
+func shutdown(ctx context.Context, srv *http.Server, q *sendQueue, pool *mail.SMTPPool, flushTraces func(context.Context) error) error {
+	var errs []error
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("peticiones interrumpidas por el apagado", "error", err)
+		srv.Close()
+		errs = append(errs, err)
+	}
+	if q != nil {
+		if err := q.Shutdown(ctx); err != nil {
+			depth, _ := q.Stats()
+			slog.Error("envíos de la cola interrumpidos por el apagado", "pending", depth, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	// QUIT a las conexiones ociosas para no dejarlas abiertas en el servidor
+	if pool != nil {
+		if err := pool.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// Los spans se envían aunque el plazo haya vencido
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := flushTraces(flushCtx); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		slog.Info("servidor detenido")
+	}
+	return errors.Join(errs...)
+}
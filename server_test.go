@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"email-api/mail"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownWaitsForRequests(t *testing.T) {
+	started := make(chan struct{})
+	srv := newHTTPServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("enviado"))
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(listener)
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	<-started
+
+	flushed := false
+	flush := func(context.Context) error {
+		flushed = true
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	pool := mail.NewSMTPPool(mail.PoolConfig{Addr: "127.0.0.1:0", MaxConns: 1})
+	require.NoError(t, shutdown(ctx, srv, nil, pool, flush))
+	require.Equal(t, "enviado", <-body)
+	require.True(t, flushed)
+
+	// Ya no acepta conexiones nuevas
+	_, err = http.Get("http://" + listener.Addr().String())
+	require.Error(t, err)
+	require.ErrorIs(t, pool.Send(context.Background(), "a@b.com", []string{"c@d.com"}, nil), mail.ErrPoolClosed)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode"
+)
+
+// Plantillas HTML incluidas en el binario
+//
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var emailTemplates = htmltemplate.Must(
+	htmltemplate.New("").Funcs(templateFuncs(locales[fallbackLocale])).Option("missingkey=error").ParseFS(templateFiles, "templates/*.html"),
+)
+
+// Un campo marcado con required que falta o está vacío
+var errMissingMergeField = errors.New("falta un campo requerido")
+
+// Filtros disponibles en todas las plantillas. Un campo inexistente es un
+// error; para campos opcionales se usa index: {{index . "apodo" | default "amigo"}}
+var mergeFuncs = map[string]any{
+	"default":   defaultValue,
+	"required":  requiredValue,
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"trim":      strings.TrimSpace,
+	"title":     titleCase,
+	"firstName": firstName,
+	"imageURL":  imageURL,
+}
+
+// Filtros con el formato de fechas y números del idioma del correo
+func templateFuncs(loc *Locale) map[string]any {
+	funcs := map[string]any{
+		"date": func(layout string, value any) (string, error) {
+			return formatDate(loc, layout, value)
+		},
+		"currency": func(code string, value any) (string, error) {
+			return formatCurrency(loc, code, value)
+		},
+		"number": func(decimals int, value any) (string, error) {
+			amount, err := toFloat(value)
+			if err != nil {
+				return "", err
+			}
+			return loc.FormatNumber(amount, decimals), nil
+		},
+	}
+	for name, fn := range mergeFuncs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// Contenido de un correo antes de aplicar los datos de plantilla
+type emailContent struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Aplicar los datos a asunto, HTML y texto. El HTML usa html/template para
+// escapar los valores; asunto y texto se renderizan sin escapar.
+func renderContent(content emailContent, data map[string]any) (emailContent, error) {
+	var rendered emailContent
+	var err error
+	if rendered.Subject, err = renderText("subject", content.Subject, data); err != nil {
+		return rendered, err
+	}
+	if rendered.Text, err = renderText("text", content.Text, data); err != nil {
+		return rendered, err
+	}
+	if rendered.HTML, err = renderHTML("html", content.HTML, data); err != nil {
+		return rendered, err
+	}
+	return rendered, nil
+}
+
+func renderText(name string, source string, data map[string]any) (string, error) {
+	if !strings.Contains(source, "{{") {
+		return source, nil
+	}
+	tmpl, err := texttemplate.New(name).Funcs(templateFuncs(localeFromData(data))).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func renderHTML(name string, source string, data map[string]any) (string, error) {
+	if !strings.Contains(source, "{{") {
+		return source, nil
+	}
+	tmpl, err := htmltemplate.New(name).Funcs(templateFuncs(localeFromData(data))).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Renderizar una de las plantillas incluidas, por ejemplo "recommendation.html"
+func renderTemplate(name string, data map[string]any) (string, error) {
+	tmpl, err := emailTemplates.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(templateFuncs(localeFromData(data)))
+
+	var out bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&out, name, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// nil, textos en blanco y listas vacías cuentan como vacíos; el número 0 no
+func isEmptyValue(value any) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// {{.apodo | default "amigo"}}
+func defaultValue(fallback any, value any) any {
+	if isEmptyValue(value) {
+		return fallback
+	}
+	return value
+}
+
+// {{.user_name | required "user_name"}} hace fallar el envío si el campo está vacío
+func requiredValue(name string, value any) (any, error) {
+	if isEmptyValue(value) {
+		return nil, fmt.Errorf("%w: %s", errMissingMergeField, name)
+	}
+	return value, nil
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+func firstName(name string) string {
+	if fields := strings.Fields(name); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// {{.fecha | date "long"}} o {{.fecha | date "02/01/2006"}}; acepta time.Time
+// o textos RFC 3339 / AAAA-MM-DD
+func formatDate(loc *Locale, layout string, value any) (string, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return loc.FormatDate(layout, v), nil
+	case string:
+		for _, input := range []string{time.RFC3339, time.DateOnly} {
+			if t, err := time.Parse(input, v); err == nil {
+				return loc.FormatDate(layout, t), nil
+			}
+		}
+		return "", fmt.Errorf("fecha inválida %q", v)
+	}
+	return "", fmt.Errorf("fecha inválida %v", value)
+}
+
+// Decimales y símbolo por moneda ISO 4217
+var currencyFormats = map[string]struct {
+	symbol   string
+	decimals int
+}{
+	"CLP": {"$", 0},
+	"USD": {"US$", 2},
+	"EUR": {"€", 2},
+	"MXN": {"MX$", 2},
+	"ARS": {"AR$", 2},
+	"COP": {"COL$", 0},
+	"PEN": {"S/", 2},
+	"JPY": {"¥", 0},
+}
+
+// {{.total | currency "CLP"}} con los separadores del idioma
+func formatCurrency(loc *Locale, code string, value any) (string, error) {
+	amount, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	format, ok := currencyFormats[strings.ToUpper(code)]
+	if !ok {
+		format.symbol, format.decimals = strings.ToUpper(code)+" ", 2
+	}
+	return format.symbol + loc.FormatNumber(amount, format.decimals), nil
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case fmt.Stringer:
+		return strconv.ParseFloat(v.String(), 64)
+	}
+	return 0, fmt.Errorf("monto inválido %v", value)
+}
+
+// Formatear con separador de miles y decimales
+func formatNumber(amount float64, decimals int, thousands string, decimal string) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scaled := strconv.FormatFloat(math.Round(amount*math.Pow10(decimals))/math.Pow10(decimals), 'f', decimals, 64)
+	integer, fraction, _ := strings.Cut(scaled, ".")
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteString(thousands)
+		}
+		grouped.WriteRune(digit)
+	}
+	if fraction != "" {
+		return sign + grouped.String() + decimal + fraction
+	}
+	return sign + grouped.String()
+}
+
+// Las imágenes incrustadas usan cid:, que html/template no considera seguro
+func imageURL(url string) htmltemplate.URL {
+	lower := strings.ToLower(url)
+	for _, scheme := range []string{"cid:", "http://", "https://", "data:image/"} {
+		if strings.HasPrefix(lower, scheme) {
+			return htmltemplate.URL(url)
+		}
+	}
+	return "#"
+}
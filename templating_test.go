@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeFilters(t *testing.T) {
+	data := map[string]any{
+		"name":     "juan carlos pérez",
+		"empty":    "",
+		"total":    1234567.891,
+		"entrega":  "2024-06-10",
+		"creado":   time.Date(2024, time.March, 5, 10, 0, 0, 0, time.UTC),
+		"cantidad": float64(0),
+	}
+	tests := map[string]string{
+		`{{.name | title}}`:                       "Juan Carlos Pérez",
+		`{{.name | firstName | upper}}`:           "JUAN",
+		`{{.empty | default "amigo"}}`:            "amigo",
+		`{{index . "apodo" | default "amigo"}}`:   "amigo",
+		`{{.cantidad | default 5}}`:               "0",
+		`{{.total | currency "CLP"}}`:             "$1,234,568",
+		`{{.total | currency "usd"}}`:             "US$1,234,567.89",
+		`{{-1.5 | currency "XYZ"}}`:               "XYZ -1.50",
+		`{{.entrega | date "02/01/2006"}}`:        "10/06/2024",
+		`{{.creado | date "2006-01-02 15:04"}}`:   "2024-03-05 10:00",
+		`{{.name | required "name" | firstName}}`: "juan",
+	}
+	for source, want := range tests {
+		got, err := renderText("test", source, data)
+		require.NoError(t, err, source)
+		require.Equal(t, want, got, source)
+	}
+
+	_, err := renderText("test", `{{.empty | required "empty"}}`, data)
+	require.True(t, errors.Is(err, errMissingMergeField), err)
+	_, err = renderText("test", `{{.name | date "2006"}}`, data)
+	require.Error(t, err)
+}
+
+func TestRecommendationTemplate(t *testing.T) {
+	contact := &Contact{Email: "juan@ejemplo.com", Name: "Juan Pérez", Attributes: map[string]string{"plan": "pro"}}
+	data, err := recommendationData(RecommendationRequest{
+		Subject:     "Hola {{.first_name}}, plan {{.contact.plan}}",
+		PhoneNumber: "+56973756474",
+		Products: []Product{
+			{Name: "Auriculares <Pro>", Image: "cid:product-0", BuyURL: "https://tienda.com/a"},
+			{Name: "Cable", Image: "javascript:alert(1)"},
+		},
+	}, contact)
+	require.NoError(t, err)
+
+	html, err := generateRecommendationHTML(data)
+	require.NoError(t, err)
+	require.Contains(t, html, "Hello, Juan Pérez")
+	require.Contains(t, html, "Auriculares &lt;Pro&gt;")
+	require.Contains(t, html, `src="cid:product-0"`)
+	require.Contains(t, html, `src="#"`)
+	require.Contains(t, html, "phone_number=%2b56973756474")
+	require.False(t, strings.Contains(html, "javascript:"))
+
+	subject, err := renderText("subject", "Hola {{.first_name}}, plan {{.contact.plan}}", data)
+	require.NoError(t, err)
+	require.Equal(t, "Hola Juan, plan pro", subject)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Colores de un tema; los que falten se toman del tema por defecto
+type ThemeColors struct {
+	Primary       string `json:"primary,omitempty"`
+	OnPrimary     string `json:"on_primary,omitempty"`
+	Text          string `json:"text,omitempty"`
+	TextSecondary string `json:"text_secondary,omitempty"`
+	Muted         string `json:"muted,omitempty"`
+	Background    string `json:"background,omitempty"`
+	Surface       string `json:"surface,omitempty"`
+	Card          string `json:"card,omitempty"`
+	Accent        string `json:"accent,omitempty"`
+}
+
+type SocialLink struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Tema de marca aplicado a las plantillas
+type Theme struct {
+	Name          string            `json:"name"`
+	Colors        ThemeColors       `json:"colors"`
+	FontFamily    string            `json:"font_family,omitempty"`
+	LogoURL       string            `json:"logo_url,omitempty"`
+	HeaderText    map[string]string `json:"header_text,omitempty"`
+	FooterAddress string            `json:"footer_address,omitempty"`
+	SocialLinks   []SocialLink      `json:"social_links,omitempty"`
+}
+
+const defaultThemeName = "default"
+
+// El estilo original en blanco y negro
+var defaultTheme = Theme{
+	Name: defaultThemeName,
+	Colors: ThemeColors{
+		Primary:       "#000",
+		OnPrimary:     "#fff",
+		Text:          "#000",
+		TextSecondary: "#333",
+		Muted:         "#666",
+		Background:    "#f0f0f0",
+		Surface:       "#ffffff",
+		Card:          "#fafafa",
+		Accent:        "#c00",
+	},
+	FontFamily: "-apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif",
+}
+
+var (
+	themeNamePattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	cssColorPattern   = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+|rgba?\([0-9., %]+\))$`)
+	fontFamilyPattern = regexp.MustCompile(`^[a-zA-Z0-9 ,'\-]+$`)
+)
+
+var errInvalidTheme = errors.New("tema inválido")
+var errThemeNotFound = errors.New("tema no encontrado")
+
+// Completar con el tema por defecto y validar los valores que van al CSS
+func (t Theme) normalize() (Theme, error) {
+	if !themeNamePattern.MatchString(t.Name) {
+		return t, fmt.Errorf("%w: nombre %q", errInvalidTheme, t.Name)
+	}
+
+	colors := []*string{&t.Colors.Primary, &t.Colors.OnPrimary, &t.Colors.Text, &t.Colors.TextSecondary,
+		&t.Colors.Muted, &t.Colors.Background, &t.Colors.Surface, &t.Colors.Card, &t.Colors.Accent}
+	defaults := []string{defaultTheme.Colors.Primary, defaultTheme.Colors.OnPrimary, defaultTheme.Colors.Text,
+		defaultTheme.Colors.TextSecondary, defaultTheme.Colors.Muted, defaultTheme.Colors.Background,
+		defaultTheme.Colors.Surface, defaultTheme.Colors.Card, defaultTheme.Colors.Accent}
+	for i, color := range colors {
+		if *color == "" {
+			*color = defaults[i]
+		}
+		if !cssColorPattern.MatchString(*color) {
+			return t, fmt.Errorf("%w: color %q", errInvalidTheme, *color)
+		}
+	}
+
+	if t.FontFamily == "" {
+		t.FontFamily = defaultTheme.FontFamily
+	}
+	if !fontFamilyPattern.MatchString(t.FontFamily) {
+		return t, fmt.Errorf("%w: font_family %q", errInvalidTheme, t.FontFamily)
+	}
+
+	if t.LogoURL != "" && !isHTTPURL(t.LogoURL) {
+		return t, fmt.Errorf("%w: logo_url debe ser una URL http(s)", errInvalidTheme)
+	}
+	for _, link := range t.SocialLinks {
+		if link.Name == "" || !isHTTPURL(link.URL) {
+			return t, fmt.Errorf("%w: red social %q requiere nombre y URL http(s)", errInvalidTheme, link.Name)
+		}
+	}
+	return t, nil
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+// Valores del tema listos para la plantilla. Los colores y la fuente ya están
+// validados, por eso se marcan como CSS seguro.
+type themeView struct {
+	Name          string
+	Primary       htmltemplate.CSS
+	OnPrimary     htmltemplate.CSS
+	Text          htmltemplate.CSS
+	TextSecondary htmltemplate.CSS
+	Muted         htmltemplate.CSS
+	Background    htmltemplate.CSS
+	Surface       htmltemplate.CSS
+	Card          htmltemplate.CSS
+	Accent        htmltemplate.CSS
+	FontFamily    htmltemplate.CSS
+	LogoURL       string
+	HeaderText    string
+	FooterAddress string
+	SocialLinks   []SocialLink
+}
+
+func (t Theme) view(loc *Locale) themeView {
+	header := t.HeaderText[loc.Code]
+	if header == "" {
+		header = loc.Messages["header"]
+	}
+	return themeView{
+		Name:          t.Name,
+		Primary:       htmltemplate.CSS(t.Colors.Primary),
+		OnPrimary:     htmltemplate.CSS(t.Colors.OnPrimary),
+		Text:          htmltemplate.CSS(t.Colors.Text),
+		TextSecondary: htmltemplate.CSS(t.Colors.TextSecondary),
+		Muted:         htmltemplate.CSS(t.Colors.Muted),
+		Background:    htmltemplate.CSS(t.Colors.Background),
+		Surface:       htmltemplate.CSS(t.Colors.Surface),
+		Card:          htmltemplate.CSS(t.Colors.Card),
+		Accent:        htmltemplate.CSS(t.Colors.Accent),
+		FontFamily:    htmltemplate.CSS(t.FontFamily),
+		LogoURL:       t.LogoURL,
+		HeaderText:    header,
+		FooterAddress: t.FooterAddress,
+		SocialLinks:   t.SocialLinks,
+	}
+}
+
+// Temas guardados como archivos <nombre>.json en THEMES_DIR
+type themeStore struct {
+	mu     sync.Mutex
+	dir    string
+	themes map[string]Theme
+	// Archivo de cada tema; el nombre del JSON puede no coincidir con el del archivo
+	paths map[string]string
+}
+
+// Solo el tema por defecto hasta que main carga THEMES_DIR
+var themes = &themeStore{themes: map[string]Theme{defaultThemeName: defaultTheme}, paths: map[string]string{}}
+
+func newThemeStore(dir string) (*themeStore, error) {
+	store := &themeStore{dir: dir, themes: map[string]Theme{defaultThemeName: defaultTheme}, paths: map[string]string{}}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var theme Theme
+		if err := json.Unmarshal(data, &theme); err != nil {
+			return nil, fmt.Errorf("error al leer %s: %v", path, err)
+		}
+		if theme.Name == "" {
+			theme.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if theme, err = theme.normalize(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		store.themes[theme.Name] = theme
+		store.paths[theme.Name] = path
+	}
+	return store, nil
+}
+
+// Tema de la marca pedida; si no se indica se usa DEFAULT_BRAND
+func (s *themeStore) Resolve(brand string) (Theme, error) {
+	if brand == "" {
+		brand = os.Getenv("DEFAULT_BRAND")
+	}
+	if brand == "" {
+		brand = defaultThemeName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	theme, ok := s.themes[brand]
+	if !ok {
+		return theme, fmt.Errorf("%w: %q", errThemeNotFound, brand)
+	}
+	return theme, nil
+}
+
+func (s *themeStore) List() []Theme {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Theme, 0, len(s.themes))
+	for _, theme := range s.themes {
+		list = append(list, theme)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Crear o reemplazar un tema y guardarlo en su archivo; si se cargó de otro
+// archivo se reescribe ese para no duplicarlo
+func (s *themeStore) Save(theme Theme) (Theme, error) {
+	theme, err := theme.normalize()
+	if err != nil {
+		return theme, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, ok := s.paths[theme.Name]
+	if !ok {
+		path = filepath.Join(s.dir, theme.Name+".json")
+	}
+	if err := writeJSONFile(path, theme); err != nil {
+		return theme, err
+	}
+	s.themes[theme.Name] = theme
+	s.paths[theme.Name] = path
+	return theme, nil
+}
+
+func (s *themeStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.themes[name]; !ok || name == defaultThemeName {
+		return fmt.Errorf("%w: %q", errThemeNotFound, name)
+	}
+	if path, ok := s.paths[name]; ok {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	delete(s.themes, name)
+	delete(s.paths, name)
+	return nil
+}
+
+func themeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidTheme):
+		return http.StatusBadRequest
+	case errors.Is(err, errThemeNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// GET /themes: temas disponibles
+func listThemesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, themes.List())
+}
+
+// GET /themes/{name}
+func getThemeHandler(w http.ResponseWriter, r *http.Request) {
+	theme, err := themes.Resolve(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), themeErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, theme)
+}
+
+// PUT /themes/{name}: crea o reemplaza un tema
+func saveThemeHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == defaultThemeName {
+		http.Error(w, "El tema por defecto no se puede modificar", http.StatusBadRequest)
+		return
+	}
+	var theme Theme
+	if err := json.NewDecoder(r.Body).Decode(&theme); err != nil {
+		http.Error(w, "Error al procesar el JSON", bodyErrorStatus(err))
+		return
+	}
+	theme.Name = name
+	saved, err := themes.Save(theme)
+	if err != nil {
+		http.Error(w, err.Error(), themeErrorStatus(err))
+		return
+	}
+	slog.InfoContext(r.Context(), "tema guardado", "theme", saved.Name)
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// DELETE /themes/{name}
+func deleteThemeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := themes.Delete(r.PathValue("name")); err != nil {
+		http.Error(w, err.Error(), themeErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
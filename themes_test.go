@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThemeNormalize(t *testing.T) {
+	theme, err := Theme{Name: "acme", Colors: ThemeColors{Primary: "#0055ff"}}.normalize()
+	require.NoError(t, err)
+	require.Equal(t, "#0055ff", theme.Colors.Primary)
+	require.Equal(t, defaultTheme.Colors.Surface, theme.Colors.Surface)
+	require.Equal(t, defaultTheme.FontFamily, theme.FontFamily)
+
+	invalid := []Theme{
+		{Name: "Acme Corp"},
+		{Name: "acme", Colors: ThemeColors{Primary: "red;} body {display:none"}},
+		{Name: "acme", FontFamily: "Arial; color: red"},
+		{Name: "acme", LogoURL: "javascript:alert(1)"},
+		{Name: "acme", SocialLinks: []SocialLink{{Name: "X", URL: "x.com/acme"}}},
+	}
+	for _, theme := range invalid {
+		_, err := theme.normalize()
+		require.True(t, errors.Is(err, errInvalidTheme), theme)
+	}
+}
+
+func TestThemeStore(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "acme.json"), []byte(`{"colors":{"primary":"#0055ff"}}`), 0o644))
+
+	store, err := newThemeStore(dir)
+	require.NoError(t, err)
+	theme, err := store.Resolve("acme")
+	require.NoError(t, err)
+	require.Equal(t, "acme", theme.Name)
+
+	_, err = store.Resolve("otra")
+	require.True(t, errors.Is(err, errThemeNotFound))
+
+	t.Setenv("DEFAULT_BRAND", "acme")
+	theme, err = store.Resolve("")
+	require.NoError(t, err)
+	require.Equal(t, "acme", theme.Name)
+
+	_, err = store.Save(Theme{Name: "tienda", Colors: ThemeColors{Accent: "rgb(200, 0, 0)"}})
+	require.NoError(t, err)
+	reloaded, err := newThemeStore(dir)
+	require.NoError(t, err)
+	require.Len(t, reloaded.List(), 3)
+
+	require.NoError(t, reloaded.Delete("tienda"))
+	require.FileExists(t, filepath.Join(dir, "acme.json"))
+	require.NoFileExists(t, filepath.Join(dir, "tienda.json"))
+	require.True(t, errors.Is(reloaded.Delete(defaultThemeName), errThemeNotFound))
+
+	// El nombre del JSON manda aunque el archivo se llame distinto
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "marca-vieja.json"), []byte(`{"name":"nueva"}`), 0o644))
+	reloaded, err = newThemeStore(dir)
+	require.NoError(t, err)
+	_, err = reloaded.Save(Theme{Name: "nueva", Colors: ThemeColors{Accent: "#112233"}})
+	require.NoError(t, err)
+	require.NoFileExists(t, filepath.Join(dir, "nueva.json"))
+	require.NoError(t, reloaded.Delete("nueva"))
+	require.NoFileExists(t, filepath.Join(dir, "marca-vieja.json"))
+	reloaded, err = newThemeStore(dir)
+	require.NoError(t, err)
+	_, err = reloaded.Resolve("nueva")
+	require.True(t, errors.Is(err, errThemeNotFound))
+}
+
+func TestRecommendationTemplateTheme(t *testing.T) {
+	products := []Product{{Name: "Auriculares", BuyURL: "https://tienda.com/a"}}
+
+	// Sin marca se mantiene el estilo original
+	data, err := recommendationData(RecommendationRequest{Products: products, Locale: "es"}, nil)
+	require.NoError(t, err)
+	html, err := generateRecommendationHTML(data)
+	require.NoError(t, err)
+	require.Contains(t, html, "background: #000;")
+	require.Contains(t, html, "background-color: #f0f0f0;")
+	require.Contains(t, html, "<h1>🎁 Ofertas especiales para ti</h1>")
+	require.NotContains(t, html, "brand-footer\">")
+
+	saved := themes
+	t.Cleanup(func() { themes = saved })
+	themes, err = newThemeStore(t.TempDir())
+	require.NoError(t, err)
+	_, err = themes.Save(Theme{
+		Name:          "acme",
+		Colors:        ThemeColors{Primary: "#0055ff", Accent: "#ff6600"},
+		FontFamily:    "Georgia, serif",
+		LogoURL:       "https://acme.com/logo.png",
+		HeaderText:    map[string]string{"es": "Novedades de Acme"},
+		FooterAddress: "Av. Siempre Viva 742, Santiago",
+		SocialLinks:   []SocialLink{{Name: "Instagram", URL: "https://instagram.com/acme"}},
+	})
+	require.NoError(t, err)
+
+	data, err = recommendationData(RecommendationRequest{Products: products, Locale: "es", Brand: "acme"}, nil)
+	require.NoError(t, err)
+	html, err = generateRecommendationHTML(data)
+	require.NoError(t, err)
+	require.Contains(t, html, "background: #0055ff;")
+	require.Contains(t, html, "font-family: Georgia, serif;")
+	require.Contains(t, html, `src="https://acme.com/logo.png"`)
+	require.Contains(t, html, "<h1>Novedades de Acme</h1>")
+	require.Contains(t, html, `<a href="https://instagram.com/acme">Instagram</a>`)
+	require.Contains(t, html, "Av. Siempre Viva 742, Santiago")
+
+	// En inglés no hay texto de cabecera propio y se usa el del catálogo
+	data, err = recommendationData(RecommendationRequest{Products: products, Locale: "en", Brand: "acme"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, locales["en"].Messages["header"], data["theme"].(themeView).HeaderText)
+
+	_, err = recommendationData(RecommendationRequest{Products: products, Brand: "otra"}, nil)
+	require.True(t, errors.Is(err, errThemeNotFound))
+}
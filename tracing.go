@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"email-api/mail"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer global; mientras no se configure un exportador no registra nada
+var tracer = otel.Tracer("email-api")
+
+// Propagación W3C (traceparent, tracestate y baggage) en las peticiones
+// recibidas, la API de llamadas y la cola
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Configura el exportador según OTEL_TRACES_EXPORTER: "otlp" (OTLP/HTTP con las
+// variables OTEL_EXPORTER_OTLP_*), "stdout" o "none" (por defecto). Devuelve la
+// función que vacía los spans pendientes al apagar el servidor.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(tracePropagator)
+
+	var option sdktrace.TracerProviderOption
+	switch value := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")); value {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		option = sdktrace.WithBatcher(exporter)
+	case "stdout", "console":
+		// En stderr para no mezclarse con los logs JSON
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		option = sdktrace.WithSyncer(exporter)
+	default:
+		return nil, fmt.Errorf("OTEL_TRACES_EXPORTER desconocido: %q", value)
+	}
+
+	// OTEL_SERVICE_NAME y OTEL_RESOURCE_ATTRIBUTES reemplazan estos valores
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("email-api")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(option, sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Termina el span marcándolo con el error. El mensaje pasa por la misma
+// redacción que los logs porque suele traer direcciones.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		message := loadRedactor().redactString("error", err.Error())
+		span.RecordError(errors.New(message))
+		span.SetStatus(codes.Error, message)
+	}
+	span.End()
+}
+
+// Span por petición, continuando el traceparent recibido. El nombre usa el
+// patrón de la ruta ("POST /api/v1/contacts/{email}") y no la ruta completa.
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method)))
+		if id := mail.RequestIDFrom(ctx); id != "" {
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(rec, r)
+
+		if r.Pattern != "" {
+			route := routeOf(r)
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+		span.End()
+	})
+}
+
+// Span de una etapa SMTP, hijo del span del envío
+func traceSMTPPhase(ctx context.Context, phase mail.SMTPPhase) func(error) {
+	_, span := tracer.Start(ctx, "smtp "+string(phase), trace.WithSpanKind(trace.SpanKindClient))
+	return func(err error) { endSpan(span, err) }
+}
+
+// Observador de las etapas SMTP: métricas y trazas
+func observeSMTPPhase(ctx context.Context, phase mail.SMTPPhase) func(error) {
+	endMetric := recordSMTPPhase(ctx, phase)
+	endSpan := traceSMTPPhase(ctx, phase)
+	return func(err error) {
+		endSpan(err)
+		endMetric(err)
+	}
+}
+
+// EmailSender con un span por envío que agrupa las etapas SMTP
+type tracedSender struct {
+	mail.EmailSender
+}
+
+func (s tracedSender) Send(ctx context.Context, msg mail.Message) error {
+	ctx, span := tracer.Start(ctx, "email send", trace.WithAttributes(
+		attribute.StringSlice("email.tags", msg.Tags),
+		attribute.Int("email.recipients", len(msg.To)+len(msg.Cc)+len(msg.Bcc)),
+		attribute.Int("email.attachments", len(msg.Attachments)),
+	))
+	err := s.EmailSender.Send(ctx, msg)
+	endSpan(span, err)
+	return err
+}
+
+// traceparent del contexto para guardarlo junto a un mensaje en cola
+func traceParentFrom(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+func withTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return tracePropagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
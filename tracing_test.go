@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"email-api/mail"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	testSpansOnce sync.Once
+	testSpans     = tracetest.NewInMemoryExporter()
+)
+
+// El tracer global se enlaza con el primer proveedor, así que todos los tests
+// comparten el mismo exportador en memoria
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	testSpansOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(testSpans)))
+	})
+	testSpans.Reset()
+	return testSpans
+}
+
+func spanByName(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no se encontró el span %q", name)
+	return tracetest.SpanStub{}
+}
+
+func TestWithTracing(t *testing.T) {
+	spans := recordSpans(t)
+
+	var received string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	}))
+	defer api.Close()
+	saved := phoneCallAPIURL
+	phoneCallAPIURL = api.URL
+	t.Cleanup(func() { phoneCallAPIURL = saved })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/call-action", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, makePhoneCall(r.Context(), "+56973756474"))
+	})
+	req := httptest.NewRequest(http.MethodGet, "/call-action", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	withTracing(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	server := spanByName(t, spans.GetSpans(), "GET /call-action")
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	require.Equal(t, trace.SpanKindServer, server.SpanKind)
+
+	client := spanByName(t, spans.GetSpans(), "POST phone API")
+	require.Equal(t, server.SpanContext.SpanID(), client.Parent.SpanID())
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+client.SpanContext.SpanID().String()+"-01", received)
+}
+
+func TestTracedSender(t *testing.T) {
+	spans := recordSpans(t)
+
+	failing := errors.New("550 buzón inexistente: ana@ejemplo.com")
+	sender := tracedSender{stubSender{err: failing}}
+	msg, err := mail.NewMessage().To("ana@ejemplo.com").Subject("Hola").Text("Hola").Tag("send").Build()
+	require.NoError(t, err)
+
+	phases := tracedSender{phaseSender{}}
+	require.NoError(t, phases.Send(context.Background(), msg))
+	send := spanByName(t, spans.GetSpans(), "email send")
+	dial := spanByName(t, spans.GetSpans(), "smtp dial")
+	require.Equal(t, send.SpanContext.SpanID(), dial.Parent.SpanID())
+
+	spans.Reset()
+	require.ErrorIs(t, sender.Send(context.Background(), msg), failing)
+	send = spanByName(t, spans.GetSpans(), "email send")
+	require.Equal(t, codes.Error, send.Status.Code)
+	require.Equal(t, "550 buzón inexistente: a***@ejemplo.com", send.Status.Description)
+}
+
+// Remitente que solo reporta la etapa de conexión
+type phaseSender struct {
+	mail.EmailSender
+}
+
+func (phaseSender) Send(ctx context.Context, msg mail.Message) error {
+	observeSMTPPhase(ctx, mail.PhaseDial)(nil)
+	return nil
+}
+
+func TestQueueTraceParent(t *testing.T) {
+	recordSpans(t)
+	ctx, span := tracer.Start(context.Background(), "lote")
+	defer span.End()
+
+	restored := trace.SpanContextFromContext(withTraceParent(context.Background(), traceParentFrom(ctx)))
+	require.Equal(t, span.SpanContext().TraceID(), restored.TraceID())
+	require.Equal(t, span.SpanContext().SpanID(), restored.SpanID())
+	require.Equal(t, context.Background(), withTraceParent(context.Background(), ""))
+}